@@ -0,0 +1,474 @@
+package cuslog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a declarative logger configuration, loaded from YAML or JSON
+// with LoadConfig and overridden from the environment with ApplyEnv.
+type Config struct {
+	Level string `json:"level" yaml:"level"`
+	// Levels sets the level of named loggers by name pattern, e.g.
+	// kafka.*: debug, see WithNameLevels.
+	Levels map[string]string `json:"levels" yaml:"levels"`
+	// Formatter is text, json, logfmt or console.
+	Formatter       string          `json:"formatter" yaml:"formatter"`
+	TimeFormat      string          `json:"time-format" yaml:"time-format"`
+	Outputs         []OutputConfig  `json:"outputs" yaml:"outputs"`
+	Sampling        *SamplingConfig `json:"sampling" yaml:"sampling"`
+	Caller          CallerConfig    `json:"caller" yaml:"caller"`
+	StacktraceLevel string          `json:"stacktrace-level" yaml:"stacktrace-level"`
+}
+
+// OutputConfig is an output of a Config. Outputs with a Level or a
+// Formatter become sinks.
+type OutputConfig struct {
+	// Path is stdout, stderr or a file name.
+	Path      string        `json:"path" yaml:"path"`
+	Level     string        `json:"level" yaml:"level"`
+	Formatter string        `json:"formatter" yaml:"formatter"`
+	Rotate    *RotateConfig `json:"rotate" yaml:"rotate"`
+}
+
+// RotateConfig configures the RotateWriter of a file output.
+type RotateConfig struct {
+	MaxSize    int    `json:"max-size" yaml:"max-size"`
+	MaxAge     string `json:"max-age" yaml:"max-age"` // a duration, e.g. 168h
+	MaxBackups int    `json:"max-backups" yaml:"max-backups"`
+	Daily      bool   `json:"daily" yaml:"daily"`
+	Compress   bool   `json:"compress" yaml:"compress"`
+	LocalTime  bool   `json:"local-time" yaml:"local-time"`
+}
+
+type SamplingConfig struct {
+	Tick       string `json:"tick" yaml:"tick"` // a duration, e.g. 1s
+	First      int    `json:"first" yaml:"first"`
+	Thereafter int    `json:"thereafter" yaml:"thereafter"`
+	ByCaller   bool   `json:"by-caller" yaml:"by-caller"`
+}
+
+type CallerConfig struct {
+	Disable     bool `json:"disable" yaml:"disable"`
+	DisableFunc bool `json:"disable-func" yaml:"disable-func"`
+	// Path is default, short or full, see CallerPath.
+	Path string `json:"path" yaml:"path"`
+	Skip int    `json:"skip" yaml:"skip"`
+}
+
+// LoadConfig reads the config file at path, JSON if its extension is
+// .json and YAML otherwise.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal(data, c)
+	} else {
+		err = yaml.Unmarshal(data, c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cuslog: parse config %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// ApplyEnv overrides c with the environment variables prefix_LEVEL,
+// prefix_LEVELS (as parsed by ParseNameLevels), prefix_FORMATTER,
+// prefix_TIME_FORMAT, prefix_OUTPUTS (a comma separated list of paths),
+// prefix_CALLER_DISABLE, prefix_CALLER_PATH and prefix_STACKTRACE_LEVEL.
+func (c *Config) ApplyEnv(prefix string) error {
+	env := func(name string) (string, bool) {
+		return os.LookupEnv(prefix + "_" + name)
+	}
+	if v, ok := env("LEVEL"); ok {
+		c.Level = v
+	}
+	if v, ok := env("LEVELS"); ok {
+		levels, err := ParseNameLevels(v)
+		if err != nil {
+			return fmt.Errorf("cuslog: %s_LEVELS: %w", prefix, err)
+		}
+		c.Levels = make(map[string]string, len(levels))
+		for name, level := range levels {
+			c.Levels[name] = level.String()
+		}
+	}
+	if v, ok := env("FORMATTER"); ok {
+		c.Formatter = v
+	}
+	if v, ok := env("TIME_FORMAT"); ok {
+		c.TimeFormat = v
+	}
+	if v, ok := env("OUTPUTS"); ok {
+		c.Outputs = nil
+		for _, path := range strings.Split(v, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				c.Outputs = append(c.Outputs, OutputConfig{Path: path})
+			}
+		}
+	}
+	if v, ok := env("CALLER_DISABLE"); ok {
+		disable, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("cuslog: %s_CALLER_DISABLE: %w", prefix, err)
+		}
+		c.Caller.Disable = disable
+	}
+	if v, ok := env("CALLER_PATH"); ok {
+		c.Caller.Path = v
+	}
+	if v, ok := env("STACKTRACE_LEVEL"); ok {
+		c.StacktraceLevel = v
+	}
+	return nil
+}
+
+// Build returns a logger configured by c, with opts applied after the
+// options of c, and a closer flushing it and closing the files opened for
+// its outputs.
+func (c *Config) Build(opts ...Option) (*logger, io.Closer, error) {
+	options, closers, err := c.options()
+	if err != nil {
+		return nil, nil, err
+	}
+	l := New(append(options, opts...)...)
+	return l, &outputCloser{logger: l, closers: closers}, nil
+}
+
+// outputCloser flushes a logger built from a Config and closes its
+// outputs.
+type outputCloser struct {
+	logger  *logger
+	closers []io.Closer
+}
+
+func (c *outputCloser) Close() error {
+	_ = c.logger.Flush()
+	err := closeAll(c.closers)
+	c.closers = nil
+	return err
+}
+
+// closeAll closes closers and returns the first error.
+func closeAll(closers []io.Closer) error {
+	var err error
+	for _, closer := range closers {
+		if cerr := closer.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// options returns the options of c, resetting everything c configures
+// so that they can be applied to a running logger, and the files opened
+// for its outputs.
+func (c *Config) options() (opts []Option, closers []io.Closer, err error) {
+	level := DebugLevel
+	if c.Level != "" {
+		if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+			return nil, nil, err
+		}
+	}
+	nameLevels := make(map[string]Level, len(c.Levels))
+	for name, s := range c.Levels {
+		var level Level
+		if err := level.UnmarshalText([]byte(s)); err != nil {
+			return nil, nil, fmt.Errorf("cuslog: level of %s: %w", name, err)
+		}
+		nameLevels[name] = level
+	}
+	formatter, err := c.formatter(c.Formatter)
+	if err != nil {
+		return nil, nil, err
+	}
+	callerPath, err := parseCallerPath(c.Caller.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sampling Sampling
+	if s := c.Sampling; s != nil {
+		if sampling.Tick, err = parseDuration(s.Tick); err != nil {
+			return nil, nil, fmt.Errorf("cuslog: sampling tick: %w", err)
+		}
+		sampling.First, sampling.Thereafter, sampling.ByCaller = s.First, s.Thereafter, s.ByCaller
+	}
+	stack := func(o *options) { o.addStack = false }
+	if c.StacktraceLevel != "" {
+		var stackLevel Level
+		if err := stackLevel.UnmarshalText([]byte(c.StacktraceLevel)); err != nil {
+			return nil, nil, err
+		}
+		stack = WithStacktraceLevel(stackLevel)
+	}
+
+	opts = []Option{
+		WithLevel(level),
+		WithNameLevels(nameLevels),
+		WithFormatter(formatter),
+		WithDisableCaller(c.Caller.Disable),
+		WithDisableCallerFunc(c.Caller.DisableFunc),
+		WithCallerSkip(c.Caller.Skip),
+		WithCallerPath(callerPath),
+		WithSampling(sampling),
+		stack,
+	}
+
+	defer func() {
+		if err != nil {
+			for _, closer := range closers {
+				_ = closer.Close()
+			}
+			closers = nil
+		}
+	}()
+	outputs := c.Outputs
+	if len(outputs) == 0 {
+		outputs = []OutputConfig{{Path: "stderr"}}
+	}
+	if len(outputs) == 1 && outputs[0].Level == "" && outputs[0].Formatter == "" {
+		w, closer, err := outputs[0].open()
+		if err != nil {
+			return nil, nil, err
+		}
+		if closer != nil {
+			closers = append(closers, closer)
+		}
+		return append(opts, WithOutput(w), WithSinks()), closers, nil
+	}
+
+	sinks := make([]Sink, 0, len(outputs))
+	for _, out := range outputs {
+		w, closer, err := out.open()
+		if err != nil {
+			return nil, closers, err
+		}
+		if closer != nil {
+			closers = append(closers, closer)
+		}
+		sink := Sink{Writer: w}
+		if out.Level != "" {
+			if err := sink.Level.UnmarshalText([]byte(out.Level)); err != nil {
+				return nil, closers, err
+			}
+		}
+		if out.Formatter != "" {
+			if sink.Formatter, err = c.formatter(out.Formatter); err != nil {
+				return nil, closers, err
+			}
+		}
+		sinks = append(sinks, sink)
+	}
+	return append(opts, WithSinks(sinks...)), closers, nil
+}
+
+func (c *Config) formatter(name string) (Formatter, error) {
+	switch strings.ToLower(name) {
+	case "", "text":
+		return &TextFormatter{TimestampFormat: c.TimeFormat}, nil
+	case "json":
+		return &JsonFormatter{TimestampFormat: c.TimeFormat}, nil
+	case "logfmt":
+		return &LogfmtFormatter{TimestampFormat: c.TimeFormat}, nil
+	case "console":
+		return &ConsoleFormatter{TimestampFormat: c.TimeFormat}, nil
+	}
+	return nil, fmt.Errorf("cuslog: unknown formatter %q", name)
+}
+
+// open returns the writer of the output and, for files, its closer.
+func (out OutputConfig) open() (io.Writer, io.Closer, error) {
+	switch out.Path {
+	case "", "stderr":
+		return os.Stderr, nil, nil
+	case "stdout":
+		return os.Stdout, nil, nil
+	}
+	if r := out.Rotate; r != nil {
+		maxAge, err := parseDuration(r.MaxAge)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cuslog: max-age of %s: %w", out.Path, err)
+		}
+		w := &RotateWriter{
+			Filename:   out.Path,
+			MaxSize:    r.MaxSize,
+			MaxAge:     maxAge,
+			MaxBackups: r.MaxBackups,
+			Daily:      r.Daily,
+			Compress:   r.Compress,
+			LocalTime:  r.LocalTime,
+		}
+		return w, w, nil
+	}
+	f, err := os.OpenFile(out.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f, nil
+}
+
+func parseCallerPath(s string) (CallerPath, error) {
+	switch strings.ToLower(s) {
+	case "", "default":
+		return CallerPathDefault, nil
+	case "short":
+		return CallerPathShort, nil
+	case "full":
+		return CallerPathFull, nil
+	}
+	return 0, fmt.Errorf("cuslog: unknown caller path %q", s)
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// ConfigWatcher keeps a logger configured by a config file, reloading it
+// when the file changes.
+type ConfigWatcher struct {
+	path      string
+	envPrefix string
+	logger    *logger
+
+	mu      sync.Mutex
+	closers []io.Closer
+	modTime time.Time
+	size    int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// WatchConfig builds a logger from the config file at path, overridden
+// by the environment variables with envPrefix unless it is empty, and
+// checks the file for changes every interval. Changes are applied to the
+// logger at once; a config that fails to load or build is reported on
+// stderr and the logger keeps its previous configuration.
+func WatchConfig(path, envPrefix string, interval time.Duration, opts ...Option) (*ConfigWatcher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("cuslog: non-positive watch interval %s", interval)
+	}
+	w := &ConfigWatcher{
+		path:      path,
+		envPrefix: envPrefix,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	w.modTime, w.size = w.stat()
+	c, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	options, closers, err := c.options()
+	if err != nil {
+		return nil, err
+	}
+	w.logger, w.closers = New(append(options, opts...)...), closers
+
+	go w.watch(interval)
+	return w, nil
+}
+
+func (w *ConfigWatcher) Logger() *logger {
+	return w.logger
+}
+
+// Reload loads the config file and applies it to the logger. Options
+// given to WatchConfig are not applied again.
+func (w *ConfigWatcher) Reload() error {
+	c, err := w.load()
+	if err != nil {
+		return err
+	}
+	options, closers, err := c.options()
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// close the old outputs once the entries still writing to them are done
+	old, _ := w.logger.replaceOptions(options...)
+	old.drain()
+	_ = closeAll(w.closers)
+	w.closers = closers
+	return nil
+}
+
+// Close stops watching and closes the files opened for the outputs.
+func (w *ConfigWatcher) Close() error {
+	select {
+	case <-w.stop:
+		return nil
+	default:
+		close(w.stop)
+	}
+	<-w.done
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_ = w.logger.Flush()
+	err := closeAll(w.closers)
+	w.closers = nil
+	return err
+}
+
+func (w *ConfigWatcher) load() (*Config, error) {
+	c, err := LoadConfig(w.path)
+	if err != nil {
+		return nil, err
+	}
+	if w.envPrefix != "" {
+		if err := c.ApplyEnv(w.envPrefix); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (w *ConfigWatcher) stat() (time.Time, int64) {
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return fi.ModTime(), fi.Size()
+}
+
+func (w *ConfigWatcher) watch(interval time.Duration) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+		modTime, size := w.stat()
+		if modTime.Equal(w.modTime) && size == w.size {
+			continue
+		}
+		w.modTime, w.size = modTime, size
+		if err := w.Reload(); err != nil {
+			fmt.Fprintf(os.Stderr, "cuslog: reload %s: %v\n", w.path, err)
+		}
+	}
+}
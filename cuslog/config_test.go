@@ -0,0 +1,100 @@
+package cuslog
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "log.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWatchConfigInterval(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), "level: info\n")
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if w, err := WatchConfig(path, "", interval); err == nil {
+			_ = w.Close()
+			t.Errorf("WatchConfig with interval %s: no error", interval)
+		}
+	}
+}
+
+func TestConfigBuildCloser(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.log")
+	c := &Config{Level: "info", Formatter: "json", Outputs: []OutputConfig{{Path: file}, {Path: file + ".err", Level: "error"}}}
+	l, closer, err := c.Build(WithDisableCaller(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Error("boom")
+	if err := closer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	for _, path := range []string{file, file + ".err"} {
+		data, err := os.ReadFile(path)
+		if err != nil || !strings.Contains(string(data), `"message":"boom"`) {
+			t.Errorf("%s: %q, %v", path, data, err)
+		}
+	}
+	// the outputs are closed
+	for _, s := range l.opt().sinks {
+		if _, err := s.Writer.Write([]byte("x\n")); err == nil {
+			t.Errorf("write to %v after Close succeeded", s.Writer)
+		}
+	}
+}
+
+func TestConfigReloadKeepsInflightEntries(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "outputs:\n  - path: "+filepath.Join(dir, "0.log")+"\n")
+	w, err := WatchConfig(path, "", time.Hour, WithDisableCaller(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const goroutines, perGoroutine = 4, 500
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				w.Logger().Info("line")
+			}
+		}()
+	}
+	for i := 1; i <= 20; i++ {
+		writeConfig(t, dir, "outputs:\n  - path: "+filepath.Join(dir, strconv.Itoa(i)+".log")+"\n")
+		if err := w.Reload(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	lines := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines += strings.Count(string(data), "\n")
+	}
+	if lines != goroutines*perGoroutine {
+		t.Errorf("got %d lines, want %d", lines, goroutines*perGoroutine)
+	}
+}
@@ -0,0 +1,60 @@
+package cuslog
+
+import "context"
+
+type ctxKey struct{}
+
+// ContextExtractor returns the fields carried by ctx which should be
+// attached to entries logged with that context.
+type ContextExtractor func(ctx context.Context) Fields
+
+// ContextKey returns an extractor emitting ctx.Value(key) as field name,
+// e.g. ContextKey("trace_id", traceIDKey{}).
+func ContextKey(name string, key interface{}) ContextExtractor {
+	return func(ctx context.Context) Fields {
+		if v := ctx.Value(key); v != nil {
+			return Fields{name: v}
+		}
+		return nil
+	}
+}
+
+// NewContext returns a copy of ctx carrying l.
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx, or the global logger if
+// there is none, bound to ctx.
+func FromContext(ctx context.Context) Logger {
+	l, ok := ctx.Value(ctxKey{}).(Logger)
+	if !ok {
+		l = L()
+	}
+	return l.WithContext(ctx)
+}
+
+func WithContext(ctx context.Context) Logger {
+	return L().WithContext(ctx)
+}
+
+// WithContext returns a child logger whose entries carry the fields
+// extracted from ctx by the registered context extractors.
+func (l *logger) WithContext(ctx context.Context) Logger {
+	c := l.clone()
+	c.ctx = ctx
+	return c
+}
+
+// SpanContextExtractor returns an extractor emitting the ids returned by
+// spanContext as the trace_id and span_id fields, to correlate the entries
+// of any output with traces. See OTLPConfig.SpanContext.
+func SpanContextExtractor(spanContext func(ctx context.Context) (traceID, spanID string)) ContextExtractor {
+	return func(ctx context.Context) Fields {
+		traceID, spanID := spanContext(ctx)
+		if traceID == "" {
+			return nil
+		}
+		return Fields{"trace_id": traceID, "span_id": spanID}
+	}
+}
@@ -0,0 +1,159 @@
+// Package cuslogtest provides an in-memory cuslog output capturing
+// structured entries, to assert in tests what a code path logged.
+package cuslogtest
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"cuslog"
+)
+
+// LoggedEntry is an entry captured by an Observer.
+type LoggedEntry struct {
+	Level   cuslog.Level
+	Name    string
+	Time    time.Time
+	Message string
+	// Fields holds both the untyped and typed fields of the entry.
+	Fields map[string]interface{}
+	File   string
+	Line   int
+	Func   string
+	Stack  string
+}
+
+// ObservedLogs is a concurrency safe list of captured entries.
+type ObservedLogs struct {
+	mu   sync.RWMutex
+	logs []LoggedEntry
+}
+
+func (o *ObservedLogs) add(e LoggedEntry) {
+	o.mu.Lock()
+	o.logs = append(o.logs, e)
+	o.mu.Unlock()
+}
+
+func (o *ObservedLogs) Len() int {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return len(o.logs)
+}
+
+// All returns a copy of the captured entries.
+func (o *ObservedLogs) All() []LoggedEntry {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	ret := make([]LoggedEntry, len(o.logs))
+	copy(ret, o.logs)
+	return ret
+}
+
+// TakeAll returns the captured entries and resets the list.
+func (o *ObservedLogs) TakeAll() []LoggedEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ret := o.logs
+	o.logs = nil
+	return ret
+}
+
+// Filter returns the entries for which keep returns true.
+func (o *ObservedLogs) Filter(keep func(LoggedEntry) bool) *ObservedLogs {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	filtered := &ObservedLogs{}
+	for _, e := range o.logs {
+		if keep(e) {
+			filtered.logs = append(filtered.logs, e)
+		}
+	}
+	return filtered
+}
+
+func (o *ObservedLogs) FilterLevel(level cuslog.Level) *ObservedLogs {
+	return o.Filter(func(e LoggedEntry) bool { return e.Level == level })
+}
+
+func (o *ObservedLogs) FilterMessage(msg string) *ObservedLogs {
+	return o.Filter(func(e LoggedEntry) bool { return e.Message == msg })
+}
+
+func (o *ObservedLogs) FilterMessageSnippet(snippet string) *ObservedLogs {
+	return o.Filter(func(e LoggedEntry) bool { return strings.Contains(e.Message, snippet) })
+}
+
+// FilterField returns the entries having the field key set to value.
+// Values are compared as stored by the typed fields, so FilterField("n", 1)
+// matches both WithField("n", 1) and cuslog.Int("n", 1).
+func (o *ObservedLogs) FilterField(key string, value interface{}) *ObservedLogs {
+	want := cuslog.Any(key, value).Value()
+	return o.Filter(func(e LoggedEntry) bool {
+		v, ok := e.Fields[key]
+		return ok && reflect.DeepEqual(v, want)
+	})
+}
+
+func (o *ObservedLogs) FilterFieldKey(key string) *ObservedLogs {
+	return o.Filter(func(e LoggedEntry) bool {
+		_, ok := e.Fields[key]
+		return ok
+	})
+}
+
+// Observer is a cuslog output capturing entries instead of writing them.
+type Observer struct {
+	logs *ObservedLogs
+}
+
+func NewObserver() (*Observer, *ObservedLogs) {
+	logs := &ObservedLogs{}
+	return &Observer{logs: logs}, logs
+}
+
+func (o *Observer) WriteEntry(e *cuslog.Entry) error {
+	fields := make(map[string]interface{}, len(e.Map)+len(e.TypedFields))
+	for k, v := range e.Map {
+		fields[k] = cuslog.Any(k, v).Value()
+	}
+	for _, f := range e.TypedFields {
+		if f.Type != cuslog.SkipType {
+			fields[f.Key] = f.Value()
+		}
+	}
+
+	o.logs.add(LoggedEntry{
+		Level:   e.Level,
+		Name:    e.Name,
+		Time:    e.Time,
+		Message: e.Msg(),
+		Fields:  fields,
+		File:    e.File,
+		Line:    e.Line,
+		Func:    e.Func,
+		Stack:   e.Stack,
+	})
+	return nil
+}
+
+// Write captures p as an info message, for outputs fed with raw bytes.
+func (o *Observer) Write(p []byte) (int, error) {
+	o.logs.add(LoggedEntry{
+		Level:   cuslog.InfoLevel,
+		Time:    time.Now(),
+		Message: strings.TrimSuffix(string(p), "\n"),
+		Fields:  map[string]interface{}{},
+	})
+	return len(p), nil
+}
+
+// New returns a logger capturing its entries at or above level, plus the
+// captured entries.
+func New(level cuslog.Level, opts ...cuslog.Option) (cuslog.Logger, *ObservedLogs) {
+	obs, logs := NewObserver()
+	opts = append([]cuslog.Option{cuslog.WithLevel(level), cuslog.WithOutput(obs)}, opts...)
+	return cuslog.New(opts...), logs
+}
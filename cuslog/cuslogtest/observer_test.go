@@ -0,0 +1,56 @@
+package cuslogtest
+
+import (
+	"testing"
+
+	"cuslog"
+)
+
+func TestObserverFilters(t *testing.T) {
+	l, logs := New(cuslog.DebugLevel)
+	l.WithField("n", 1).Info("untyped")
+	l.Infow("typed", cuslog.Int("n", 1))
+	l.Infow("other", cuslog.Int("n", 2), cuslog.String("user", "bob"))
+	l.Warn("careful")
+	l.Debug("hidden details")
+	l.Trace("below the level")
+
+	if n := logs.Len(); n != 5 {
+		t.Fatalf("captured %d entries, want 5", n)
+	}
+	if got := logs.FilterField("n", 1).All(); len(got) != 2 || got[0].Message != "untyped" || got[1].Message != "typed" {
+		t.Errorf("FilterField(n, 1) = %+v", got)
+	}
+	if got := logs.FilterFieldKey("user").All(); len(got) != 1 || got[0].Fields["user"] != "bob" {
+		t.Errorf("FilterFieldKey(user) = %+v", got)
+	}
+	if got := logs.FilterLevel(cuslog.WarnLevel).All(); len(got) != 1 || got[0].Message != "careful" {
+		t.Errorf("FilterLevel(WARN) = %+v", got)
+	}
+	if got := logs.FilterMessage("typed").All(); len(got) != 1 || got[0].Fields["n"] != logs.FilterMessage("untyped").All()[0].Fields["n"] {
+		t.Errorf("FilterMessage(typed) = %+v", got)
+	}
+	if n := logs.FilterMessageSnippet("de").Len(); n != 1 {
+		t.Errorf("FilterMessageSnippet(de) matched %d entries, want 1", n)
+	}
+	if n := logs.FilterLevel(cuslog.InfoLevel).FilterField("n", 2).Len(); n != 1 {
+		t.Errorf("chained filters matched %d entries, want 1", n)
+	}
+}
+
+func TestObserverTakeAll(t *testing.T) {
+	l, logs := New(cuslog.InfoLevel)
+	l.Info("one")
+	l.Info("two")
+
+	if got := logs.TakeAll(); len(got) != 2 || got[0].Message != "one" || got[1].Message != "two" {
+		t.Errorf("TakeAll() = %+v", got)
+	}
+	if n := logs.Len(); n != 0 {
+		t.Errorf("%d entries left after TakeAll", n)
+	}
+	l.Info("three")
+	if got := logs.All(); len(got) != 1 || got[0].Message != "three" {
+		t.Errorf("All() after TakeAll = %+v", got)
+	}
+}
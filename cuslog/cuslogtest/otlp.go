@@ -0,0 +1,129 @@
+package cuslogtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"cuslog"
+)
+
+// OTLPReceiver is an in-process OTLP/HTTP logs endpoint capturing the
+// records sent by a cuslog.OTLPExporter. The code.* attributes of the
+// records become the caller of the captured entries, the trace and span
+// ids their trace_id and span_id fields.
+type OTLPReceiver struct {
+	*httptest.Server
+	logs *ObservedLogs
+}
+
+// NewOTLPReceiver starts a receiver, to be closed by the caller, and
+// returns it with the captured entries.
+func NewOTLPReceiver() (*OTLPReceiver, *ObservedLogs) {
+	r := &OTLPReceiver{logs: &ObservedLogs{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	return r, r.logs
+}
+
+// Endpoint returns the logs URL to set as OTLPConfig.Endpoint.
+func (r *OTLPReceiver) Endpoint() string {
+	return r.URL + "/v1/logs"
+}
+
+type otlpRequest struct {
+	ResourceLogs []struct {
+		ScopeLogs []struct {
+			LogRecords []otlpRecord `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+type otlpRecord struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	SeverityText string         `json:"severityText"`
+	Body         otlpValue      `json:"body"`
+	Attributes   []otlpKeyValue `json:"attributes"`
+	TraceID      string         `json:"traceId"`
+	SpanID       string         `json:"spanId"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue"`
+	IntValue    *string  `json:"intValue"`
+	BoolValue   *bool    `json:"boolValue"`
+	DoubleValue *float64 `json:"doubleValue"`
+}
+
+func (v otlpValue) value() interface{} {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.IntValue != nil:
+		n, _ := strconv.ParseInt(*v.IntValue, 10, 64)
+		return n
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	}
+	return nil
+}
+
+func (r *OTLPReceiver) serve(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost || req.URL.Path != "/v1/logs" {
+		http.NotFound(w, req)
+		return
+	}
+	var body otlpRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, rl := range body.ResourceLogs {
+		for _, sl := range rl.ScopeLogs {
+			for _, rec := range sl.LogRecords {
+				r.logs.add(rec.entry())
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte("{}"))
+}
+
+func (rec otlpRecord) entry() LoggedEntry {
+	e := LoggedEntry{Fields: make(map[string]interface{}, len(rec.Attributes))}
+	_ = e.Level.UnmarshalText([]byte(rec.SeverityText))
+	if ns, err := strconv.ParseInt(rec.TimeUnixNano, 10, 64); err == nil {
+		e.Time = time.Unix(0, ns)
+	}
+	e.Message, _ = rec.Body.value().(string)
+	for _, kv := range rec.Attributes {
+		v := kv.Value.value()
+		switch kv.Key {
+		case cuslog.FieldKeyName:
+			e.Name, _ = v.(string)
+		case "code.filepath":
+			e.File, _ = v.(string)
+		case "code.lineno":
+			line, _ := v.(int64)
+			e.Line = int(line)
+		case "code.function":
+			e.Func, _ = v.(string)
+		case "code.stacktrace":
+			e.Stack, _ = v.(string)
+		default:
+			e.Fields[kv.Key] = v
+		}
+	}
+	if rec.TraceID != "" {
+		e.Fields["trace_id"], e.Fields["span_id"] = rec.TraceID, rec.SpanID
+	}
+	return e
+}
@@ -0,0 +1,61 @@
+package cuslogtest
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+
+	"cuslog"
+)
+
+type spanKey struct{}
+
+func spanContext(ctx context.Context) (string, string) {
+	if ids, ok := ctx.Value(spanKey{}).([2]string); ok {
+		return ids[0], ids[1]
+	}
+	return "", ""
+}
+
+func TestOTLPExporter(t *testing.T) {
+	recv, logs := NewOTLPReceiver()
+	defer recv.Close()
+	x := cuslog.NewOTLPExporter(cuslog.OTLPConfig{
+		Endpoint:    recv.Endpoint(),
+		ServiceName: "api",
+		SpanContext: spanContext,
+	})
+	defer x.Close()
+	l := cuslog.New(cuslog.WithOutput(x))
+
+	traceID, spanID := "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	ctx := context.WithValue(context.Background(), spanKey{}, [2]string{traceID, spanID})
+	_, file, line, _ := runtime.Caller(0)
+	l.Named("http").WithContext(ctx).Warnw("slow request", cuslog.Int("status", 503), cuslog.String("path", "/users"))
+	l.Info("no span")
+	if err := x.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	e := entries[0]
+	if e.Level != cuslog.WarnLevel || e.Name != "http" || e.Message != "slow request" {
+		t.Errorf("got %v %q %q, want WARN http slow request", e.Level, e.Name, e.Message)
+	}
+	if e.File != file || e.Line != line+1 || !strings.HasSuffix(e.Func, "TestOTLPExporter") {
+		t.Errorf("caller %s:%d %s, want %s:%d TestOTLPExporter", e.File, e.Line, e.Func, file, line+1)
+	}
+	want := map[string]interface{}{"status": int64(503), "path": "/users", "trace_id": traceID, "span_id": spanID}
+	for k, v := range want {
+		if e.Fields[k] != v {
+			t.Errorf("field %s = %#v, want %#v", k, e.Fields[k], v)
+		}
+	}
+	if e := entries[1]; e.Level != cuslog.InfoLevel || e.Fields["trace_id"] != nil {
+		t.Errorf("second entry %v with fields %v", e.Level, e.Fields)
+	}
+}
@@ -2,22 +2,41 @@ package cuslog
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type Entry struct {
-	logger *logger
-	Buffer *bytes.Buffer
-	Map    map[string]interface{}
-	Level  Level
+	logger      *logger
+	opt         *options // options of logger when e was taken
+	Buffer      *bytes.Buffer
+	Map         map[string]interface{}
+	TypedFields []Field
+	Context     context.Context
+	Level       Level
+	// Name is the name of the logger, see Named.
+	Name   string
 	Time   time.Time
 	File   string
 	Line   int
 	Func   string
 	Format string
 	Args   []interface{}
+	// Message is the message of entries logged without format and args,
+	// e.g. by Infow, see Msg for the message of any entry.
+	Message string
+	// Stack is the stack trace of entries at or above the stacktrace level.
+	Stack string
+
+	rendered bool      // Message holds the rendered Format and Args
+	pc       uintptr   // return address of the caller, 0 if unknown
+	scratch  []byte    // encoding buffer of the formatters
+	out      io.Writer // output or sink writer e is being formatted for
 }
 
 func entry(logger *logger) *Entry {
@@ -25,39 +44,223 @@ func entry(logger *logger) *Entry {
 }
 
 func (e *Entry) write(level Level, format string, args ...interface{}) {
-	if e.logger.opt.level > level {
+	if !e.logger.enabled(e.opt, level) {
+		e.release()
+		return
+	}
+	e.Format, e.Args = format, args
+	e.TypedFields = append(e.TypedFields, e.logger.typed...)
+	e.log(level)
+}
+
+func (e *Entry) writew(level Level, msg string, fields []Field) {
+	if !e.logger.enabled(e.opt, level) {
+		e.release()
 		return
 	}
+	e.Message = msg
+	e.TypedFields = append(append(e.TypedFields, e.logger.typed...), fields...)
+	e.log(level)
+}
+
+// log stamps e with the time and caller, then emits it unless it is
+// sampled out. It must be called by write or writew only, so that the
+// caller is found at a fixed depth.
+func (e *Entry) log(level Level) {
 	e.Time = time.Now()
 	e.Level = level
-	e.Format = format
-	e.Args = args
-	if !e.logger.opt.disableCaller {
-		if pc, file, line, ok := runtime.Caller(2); !ok {
-			e.File = "???"
-			e.Func = "???"
-		} else {
-			e.File, e.Line, e.Func = file, line, runtime.FuncForPC(pc).Name()
-			e.Func = e.Func[strings.LastIndex(e.Func, "/")+1:]
-		}
-	}
-	e.format()
-	e.writer()
+	if !e.opt.disableCaller {
+		e.setCaller(callerPC(3 + e.opt.callerSkip))
+	}
+	e.dispatch()
+}
+
+// setCaller sets the caller of e from the return address pc.
+func (e *Entry) setCaller(pc uintptr) {
+	e.pc = pc
+	// pc is a return address, step back into the call instruction
+	f := runtime.FuncForPC(pc - 1)
+	if f == nil {
+		e.File = "???"
+		e.Func = "???"
+		return
+	}
+	e.File, e.Line = f.FileLine(pc - 1)
+	if !e.opt.disableFunc {
+		e.Func = f.Name()
+		e.Func = e.Func[strings.LastIndex(e.Func, "/")+1:]
+	}
+}
+
+// callerFile returns the file of the caller as set by WithCallerPath, or
+// its name only if short and the path is left to the formatter.
+func (e *Entry) callerFile(short bool) string {
+	path := CallerPathDefault
+	if e.opt != nil {
+		path = e.opt.callerPath
+	}
+	switch path {
+	case CallerPathShort:
+		return shortPath(e.File)
+	case CallerPathFull:
+		return e.File
+	}
+	if short {
+		return shortFile(e.File)
+	}
+	return e.File
+}
+
+// callerPC is runtime.Caller without its allocations: it returns the
+// return address of the frame skip frames above the caller of callerPC.
+func callerPC(skip int) uintptr {
+	var pcs [1]uintptr
+	if runtime.Callers(skip+2, pcs[:]) < 1 {
+		return 0
+	}
+	return pcs[0]
+}
+
+// dispatch adds the stack trace to e and emits it, unless it is sampled
+// out.
+func (e *Entry) dispatch() {
+	if s := e.opt.sampler; s != nil {
+		keep, reports := s.check(e)
+		if len(reports) > 0 {
+			e.logger.reportSampled(s, reports, e.Time)
+		}
+		if !keep {
+			e.release()
+			return
+		}
+	}
+	e.addStack()
+	e.emit()
+}
+
+// emit adds the context and logger fields to e, redacts it, fires the
+// hooks, writes e to the outputs and releases it.
+func (e *Entry) emit() {
+	if e.Context == nil {
+		e.Context = e.logger.ctx
+	}
+	if ctx := e.Context; ctx != nil {
+		for _, extract := range e.opt.ctxExtractors {
+			for k, v := range extract(ctx) {
+				e.Map[k] = v
+			}
+		}
+	}
+	for k, v := range e.logger.fields {
+		e.Map[k] = v
+	}
+	if r := e.opt.redactor; r != nil {
+		r.redact(e)
+	}
+	e.opt.hooks.Fire(e)
+	e.output()
 	e.release()
 }
 
-func (e *Entry) format() {
-	_ = e.logger.opt.formatter.Format(e)
+// Msg returns the message of e: Format and Args rendered on first use,
+// or Message if both are empty.
+func (e *Entry) Msg() string {
+	if e.rendered {
+		return e.Message
+	}
+	e.rendered = true
+	switch {
+	case e.Format != FmtEmptySeparate:
+		e.Message = fmt.Sprintf(e.Format, e.Args...)
+	case len(e.Args) > 0:
+		e.Message = fmt.Sprint(e.Args...)
+	}
+	return e.Message
 }
 
-func (e *Entry) writer() {
+func (e *Entry) output() {
+	o := e.opt
+	if len(o.sinks) == 0 {
+		if w, ok := o.output.(EntryWriter); ok {
+			e.writeEntry(w)
+			return
+		}
+		e.out = o.output
+		e.format(o.formatter)
+		e.writer(o.writer())
+		return
+	}
+
+	// format once per distinct formatter, then write to every sink using it
+	for i := range o.sinks {
+		if !o.sinks[i].enabled(e.Level) {
+			continue
+		}
+		group := o.sinks[i].group
+		if group == entryGroup {
+			e.writeEntry(o.sinks[i].Writer.(EntryWriter))
+			continue
+		}
+		f := o.sinks[i].formatter(o)
+		if d, ok := f.(interface{ perDestination() bool }); ok && d.perDestination() {
+			// e.g. colored for terminals only, format for each sink
+			e.Buffer.Reset()
+			e.out = o.sinks[i].Writer
+			e.format(f)
+			e.writer(o.sinks[i].Writer)
+			continue
+		}
+		if e.formattedBefore(o.sinks[:i], group) {
+			continue
+		}
+		e.Buffer.Reset()
+		e.out = o.sinks[i].Writer
+		e.format(f)
+		for j := i; j < len(o.sinks); j++ {
+			if o.sinks[j].enabled(e.Level) && o.sinks[j].group == group {
+				e.writer(o.sinks[j].Writer)
+			}
+		}
+	}
+}
+
+func (e *Entry) formattedBefore(sinks []Sink, group int) bool {
+	for i := range sinks {
+		if sinks[i].enabled(e.Level) && sinks[i].group == group {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Entry) format(f Formatter) {
+	_ = f.Format(e)
+}
+
+func (e *Entry) writer(w io.Writer) {
 	e.logger.mu.Lock()
-	_, _ = e.logger.opt.output.Write(e.Buffer.Bytes())
+	_, _ = w.Write(e.Buffer.Bytes())
+	e.logger.mu.Unlock()
+}
+
+func (e *Entry) writeEntry(w EntryWriter) {
+	e.logger.mu.Lock()
+	_ = w.WriteEntry(e)
 	e.logger.mu.Unlock()
 }
 
 func (e *Entry) release() {
-	e.Args, e.Line, e.File, e.Format, e.Func = nil, 0, "", "", ""
+	e.Args, e.Line, e.File, e.Format, e.Func, e.pc = nil, 0, "", "", "", 0
+	e.Message, e.rendered, e.Context, e.Stack, e.out = "", false, nil, "", nil
+	for i := range e.TypedFields {
+		e.TypedFields[i] = Field{}
+	}
+	e.TypedFields = e.TypedFields[:0]
 	e.Buffer.Reset()
+	for k := range e.Map {
+		delete(e.Map, k)
+	}
+	atomic.AddInt64(e.opt.inflight, -1)
+	e.opt = nil
 	e.logger.entryPool.Put(e)
 }
@@ -1,8 +1,7 @@
 package main
 
 import (
-	"log"
-	"os"
+	"time"
 
 	"cuslog"
 )
@@ -15,11 +14,16 @@ func main() {
 	cuslog.Debug("log in json format")
 	cuslog.Info("another log in json format")
 
-	// 输出到文件
-	fd, err := os.OpenFile("test.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Fatalln("create file test.log failed")
+	// 输出到文件, 按大小和天切割
+	fd := &cuslog.RotateWriter{
+		Filename:   "test.log",
+		MaxSize:    100,
+		MaxAge:     7 * 24 * time.Hour,
+		MaxBackups: 10,
+		Daily:      true,
+		Compress:   true,
 	}
+	fd.ReopenOnSignal()
 	defer fd.Close()
 
 	l := cuslog.New(cuslog.WithLevel(cuslog.InfoLevel),
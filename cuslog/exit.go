@@ -0,0 +1,92 @@
+package cuslog
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Syncer is implemented by outputs buffering data, Sync flushes it.
+type Syncer interface {
+	Sync() error
+}
+
+var (
+	exitMu       sync.Mutex
+	exitHandlers []func()
+)
+
+// RegisterExitHandler adds a handler run by Fatal before exiting, after
+// the outputs have been synced. Handlers run in registration order. Panic
+// only syncs the outputs and doesn't run them, as the panic may be
+// recovered.
+func RegisterExitHandler(handler func()) {
+	exitMu.Lock()
+	exitHandlers = append(exitHandlers, handler)
+	exitMu.Unlock()
+}
+
+func runExitHandlers() {
+	exitMu.Lock()
+	handlers := make([]func(), len(exitHandlers))
+	copy(handlers, exitHandlers)
+	exitMu.Unlock()
+
+	for _, handler := range handlers {
+		runExitHandler(handler)
+	}
+}
+
+func runExitHandler(handler func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			fmt.Fprintf(os.Stderr, "cuslog: exit handler panicked: %v\n", err)
+		}
+	}()
+	handler()
+}
+
+func Sync() error {
+	return StdLogger().Sync()
+}
+
+// Sync reports the entries suppressed by sampling, drains the async queue
+// and syncs the outputs implementing Syncer.
+func (l *logger) Sync() error {
+	if s := l.opt().sampler; s != nil {
+		l.reportPending(s)
+	}
+	var err error
+	keep := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+
+	if w := l.opt().async; w != nil {
+		keep(w.Sync())
+	} else if s, ok := l.opt().output.(Syncer); ok {
+		keep(s.Sync())
+	}
+	for _, sink := range l.opt().sinks {
+		switch w := sink.Writer.(type) {
+		case Syncer:
+			keep(w.Sync())
+		case interface{ Flush() error }:
+			keep(w.Flush())
+		}
+	}
+	return err
+}
+
+// exit syncs the outputs, runs the exit handlers and calls the exit
+// function, os.Exit unless set by WithExitFunc.
+func (l *logger) exit(code int) {
+	_ = l.Sync()
+	runExitHandlers()
+	if exit := l.opt().exitFunc; exit != nil {
+		exit(code)
+		return
+	}
+	os.Exit(code)
+}
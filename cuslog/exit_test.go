@@ -0,0 +1,42 @@
+package cuslog
+
+import (
+	"io"
+	"sync/atomic"
+	"testing"
+)
+
+type syncCounter struct {
+	io.Writer
+	syncs int32
+}
+
+func (s *syncCounter) Sync() error {
+	atomic.AddInt32(&s.syncs, 1)
+	return nil
+}
+
+func TestExitHandlersRunOnFatalOnly(t *testing.T) {
+	var handled int32
+	RegisterExitHandler(func() { atomic.AddInt32(&handled, 1) })
+	out := &syncCounter{Writer: io.Discard}
+	var code int
+	l := New(WithOutput(out), WithExitFunc(func(c int) { code = c }))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Panic didn't panic")
+			}
+		}()
+		l.Panic("recoverable")
+	}()
+	if out.syncs != 1 || handled != 0 {
+		t.Errorf("after Panic: %d syncs and %d handler runs, want 1 and 0", out.syncs, handled)
+	}
+
+	l.Fatal("fatal")
+	if out.syncs != 2 || handled != 1 || code != 1 {
+		t.Errorf("after Fatal: %d syncs, %d handler runs and code %d, want 2, 1 and 1", out.syncs, handled, code)
+	}
+}
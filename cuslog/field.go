@@ -0,0 +1,220 @@
+package cuslog
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// FieldType tells how the value of a Field is stored.
+type FieldType uint8
+
+const (
+	// SkipType fields are not rendered, e.g. Err(nil).
+	SkipType FieldType = iota
+	StringType
+	IntType
+	UintType
+	BoolType
+	FloatType
+	DurationType
+	TimeType
+	ErrorType
+	AnyType
+)
+
+// Field is a typed key/value pair. The value is stored without boxing for
+// the common types so that logging with typed fields does not allocate.
+type Field struct {
+	Key       string
+	Type      FieldType
+	Integer   int64
+	String    string
+	Interface interface{}
+}
+
+func String(key, val string) Field {
+	return Field{Key: key, Type: StringType, String: val}
+}
+
+func Int(key string, val int) Field {
+	return Int64(key, int64(val))
+}
+
+func Int64(key string, val int64) Field {
+	return Field{Key: key, Type: IntType, Integer: val}
+}
+
+func Uint64(key string, val uint64) Field {
+	return Field{Key: key, Type: UintType, Integer: int64(val)}
+}
+
+func Bool(key string, val bool) Field {
+	var i int64
+	if val {
+		i = 1
+	}
+	return Field{Key: key, Type: BoolType, Integer: i}
+}
+
+func Float64(key string, val float64) Field {
+	return Field{Key: key, Type: FloatType, Integer: int64(math.Float64bits(val))}
+}
+
+func Duration(key string, val time.Duration) Field {
+	return Field{Key: key, Type: DurationType, Integer: int64(val)}
+}
+
+func Time(key string, val time.Time) Field {
+	return Field{Key: key, Type: TimeType, Integer: val.UnixNano(), Interface: val.Location()}
+}
+
+// Err is NamedErr("error", err).
+func Err(err error) Field {
+	return NamedErr("error", err)
+}
+
+// NamedErr stores err under key, a nil err is skipped.
+func NamedErr(key string, err error) Field {
+	if err == nil {
+		return Field{Key: key, Type: SkipType}
+	}
+	return Field{Key: key, Type: ErrorType, Interface: err}
+}
+
+// Any picks the typed constructor matching val, falling back to storing
+// val as is.
+func Any(key string, val interface{}) Field {
+	switch v := val.(type) {
+	case string:
+		return String(key, v)
+	case int:
+		return Int(key, v)
+	case int64:
+		return Int64(key, v)
+	case uint64:
+		return Uint64(key, v)
+	case bool:
+		return Bool(key, v)
+	case float64:
+		return Float64(key, v)
+	case time.Duration:
+		return Duration(key, v)
+	case time.Time:
+		return Time(key, v)
+	case error:
+		return NamedErr(key, v)
+	}
+	return Field{Key: key, Type: AnyType, Interface: val}
+}
+
+// Value returns the value of f as a Go value.
+func (f Field) Value() interface{} {
+	switch f.Type {
+	case StringType:
+		return f.String
+	case IntType:
+		return f.Integer
+	case UintType:
+		return uint64(f.Integer)
+	case BoolType:
+		return f.Integer == 1
+	case FloatType:
+		return math.Float64frombits(uint64(f.Integer))
+	case DurationType:
+		return time.Duration(f.Integer)
+	case TimeType:
+		return f.time()
+	case ErrorType, AnyType:
+		return f.Interface
+	}
+	return nil
+}
+
+func (f Field) time() time.Time {
+	t := time.Unix(0, f.Integer)
+	if loc, ok := f.Interface.(*time.Location); ok {
+		t = t.In(loc)
+	}
+	return t
+}
+
+// appendText appends the value of f as plain unquoted text.
+func (f Field) appendText(dst []byte) []byte {
+	switch f.Type {
+	case StringType:
+		return append(dst, f.String...)
+	case IntType:
+		return strconv.AppendInt(dst, f.Integer, 10)
+	case UintType:
+		return strconv.AppendUint(dst, uint64(f.Integer), 10)
+	case BoolType:
+		return strconv.AppendBool(dst, f.Integer == 1)
+	case FloatType:
+		return strconv.AppendFloat(dst, math.Float64frombits(uint64(f.Integer)), 'g', -1, 64)
+	case DurationType:
+		return appendDuration(dst, time.Duration(f.Integer))
+	case TimeType:
+		return f.time().AppendFormat(dst, time.RFC3339Nano)
+	case ErrorType:
+		return append(dst, f.Interface.(error).Error()...)
+	case AnyType:
+		return append(dst, fmt.Sprint(f.Interface)...)
+	}
+	return dst
+}
+
+// appendTextValue appends the value of f for the text formatters, quoted
+// if it contains spaces or other separators.
+func (f Field) appendTextValue(dst []byte) []byte {
+	switch f.Type {
+	case StringType:
+		return appendMaybeQuoted(dst, f.String)
+	case ErrorType:
+		return appendMaybeQuoted(dst, f.Interface.(error).Error())
+	case AnyType:
+		return appendMaybeQuoted(dst, fmt.Sprint(f.Interface))
+	}
+	return f.appendText(dst)
+}
+
+// appendJSON appends the value of f as JSON.
+func (f Field) appendJSON(dst []byte) []byte {
+	switch f.Type {
+	case StringType:
+		return appendJSONString(dst, f.String)
+	case IntType, UintType, BoolType:
+		return f.appendText(dst)
+	case FloatType:
+		v := math.Float64frombits(uint64(f.Integer))
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return appendJSONString(dst, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		return strconv.AppendFloat(dst, v, 'g', -1, 64)
+	case DurationType, TimeType:
+		dst = append(dst, '"')
+		dst = f.appendText(dst)
+		return append(dst, '"')
+	case ErrorType:
+		return appendJSONString(dst, f.Interface.(error).Error())
+	case AnyType:
+		return appendJSONValue(dst, f.Interface)
+	}
+	return append(dst, "null"...)
+}
+
+// appendJSONValue appends v marshalled as JSON, errors as their message
+// and values which can't be marshalled as their fmt representation.
+func appendJSONValue(dst []byte, v interface{}) []byte {
+	if err, ok := v.(error); ok {
+		return appendJSONString(dst, err.Error())
+	}
+	data, err := jsoniter.Marshal(v)
+	if err != nil {
+		return appendJSONString(dst, fmt.Sprint(v))
+	}
+	return append(dst, data...)
+}
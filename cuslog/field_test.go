@@ -0,0 +1,104 @@
+package cuslog
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+var errBoom = errors.New("boom")
+
+func logTyped(l *logger) {
+	l.Infow("request done",
+		String("path", "/api/v1/users"),
+		Int("status", 200),
+		Duration("elapsed", 1500*time.Microsecond),
+		Err(errBoom),
+	)
+}
+
+func logInfof(l *logger) {
+	l.Infof("request %s done with %d in %s", "/api/v1/users", 200, 1500*time.Microsecond)
+}
+
+func discardLogger(f Formatter) *logger {
+	return New(WithOutput(io.Discard), WithFormatter(f))
+}
+
+func withRequest(l Logger) Logger {
+	return l.With(String("request_id", "9f2c"), Int("user", 42))
+}
+
+// TestTypedFieldsDoNotAllocate checks that logging the common field types,
+// as arguments or through With, doesn't allocate. Calls through the Logger
+// interface allocate the variadic fields, which escape.
+func TestTypedFieldsDoNotAllocate(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector allocates")
+	}
+	for _, tt := range []struct {
+		name string
+		f    Formatter
+	}{
+		{"json", &JsonFormatter{}},
+		{"text", &TextFormatter{}},
+	} {
+		l := discardLogger(tt.f)
+		with := withRequest(l)
+		if n := testing.AllocsPerRun(100, func() { logTyped(l) }); n != 0 {
+			t.Errorf("%s typed: %v allocs per entry", tt.name, n)
+		}
+		if n := testing.AllocsPerRun(100, func() { with.Infow("request done") }); n != 0 {
+			t.Errorf("%s with: %v allocs per entry", tt.name, n)
+		}
+	}
+}
+
+func BenchmarkJSONTyped(b *testing.B) {
+	l := discardLogger(&JsonFormatter{})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logTyped(l)
+	}
+}
+
+func BenchmarkJSONWith(b *testing.B) {
+	l := withRequest(discardLogger(&JsonFormatter{}))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Infow("request done")
+	}
+}
+
+func BenchmarkJSONInfof(b *testing.B) {
+	l := discardLogger(&JsonFormatter{})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logInfof(l)
+	}
+}
+
+func BenchmarkTextTyped(b *testing.B) {
+	l := discardLogger(&TextFormatter{})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logTyped(l)
+	}
+}
+
+func BenchmarkTextWith(b *testing.B) {
+	l := withRequest(discardLogger(&TextFormatter{}))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Infow("request done")
+	}
+}
+
+func BenchmarkTextInfof(b *testing.B) {
+	l := discardLogger(&TextFormatter{})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logInfof(l)
+	}
+}
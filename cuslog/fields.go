@@ -0,0 +1,52 @@
+package cuslog
+
+// Fields is a set of key/value pairs attached to every entry of a logger.
+type Fields map[string]interface{}
+
+func WithField(key string, value interface{}) Logger {
+	return L().WithField(key, value)
+}
+
+func WithFields(fields Fields) Logger {
+	return L().WithFields(fields)
+}
+
+// WithField returns a child logger which adds key=value to all its entries.
+func (l *logger) WithField(key string, value interface{}) Logger {
+	return l.withFields(Fields{key: value})
+}
+
+// WithFields returns a child logger which adds fields to all its entries.
+// Fields of the child override fields of the same key inherited from l.
+func (l *logger) WithFields(fields Fields) Logger {
+	return l.withFields(fields)
+}
+
+func (l *logger) withFields(fields Fields) *logger {
+	c := l.clone()
+	c.fields = make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		c.fields[k] = v
+	}
+	for k, v := range fields {
+		c.fields[k] = v
+	}
+	return c
+}
+
+func With(fields ...Field) Logger {
+	return L().With(fields...)
+}
+
+// With returns a child logger which adds the typed fields to all its
+// entries.
+func (l *logger) With(fields ...Field) Logger {
+	return l.with(fields)
+}
+
+func (l *logger) with(fields []Field) *logger {
+	c := l.clone()
+	c.typed = make([]Field, 0, len(l.typed)+len(fields))
+	c.typed = append(append(c.typed, l.typed...), fields...)
+	return c
+}
@@ -1,8 +1,89 @@
 package cuslog
 
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// RFC3339Milli is RFC3339 with millisecond precision.
+const RFC3339Milli = "2006-01-02T15:04:05.000Z07:00"
+
+// Keys of the basic fields, used as keys of FieldMap.
+const (
+	FieldKeyTime  = "time"
+	FieldKeyLevel = "level"
+	FieldKeyMsg   = "message"
+	FieldKeyFile  = "file"
+	FieldKeyFunc  = "func"
+	FieldKeyName  = "logger"
+
+	FieldKeyStacktrace = "stacktrace"
+)
+
+// FieldMap renames the basic fields, e.g.
+// FieldMap{FieldKeyTime: "@timestamp", FieldKeyLevel: "log.level"}.
+type FieldMap map[string]string
+
+// resolve returns the name key is mapped to, or def if it is not mapped.
+func (m FieldMap) resolve(key, def string) string {
+	if name, ok := m[key]; ok {
+		return name
+	}
+	return def
+}
+
+// formatTime formats t with layout, RFC3339 if empty, in loc or UTC when
+// set, otherwise in the location of t.
+func formatTime(t time.Time, layout string, utc bool, loc *time.Location) string {
+	return string(appendTime(nil, t, layout, utc, loc))
+}
+
+func appendTime(dst []byte, t time.Time, layout string, utc bool, loc *time.Location) []byte {
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	if utc {
+		t = t.UTC()
+	} else if loc != nil {
+		t = t.In(loc)
+	}
+	return t.AppendFormat(dst, layout)
+}
 
 type Formatter interface {
 	// Format Maybe in async goroutine
 	// Please write the result to buffer
 	Format(entry *Entry) error
 }
+
+// shortFile returns the last path element of file.
+func shortFile(file string) string {
+	for i := len(file) - 1; i > 0; i-- {
+		if file[i] == '/' {
+			return file[i+1:]
+		}
+	}
+	return file
+}
+
+// shortPath returns the last directory and file name of file.
+func shortPath(file string) string {
+	idx := strings.LastIndexByte(file, '/')
+	if idx <= 0 {
+		return file
+	}
+	if idx = strings.LastIndexByte(file[:idx], '/'); idx < 0 {
+		return file
+	}
+	return file[idx+1:]
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,149 @@
+package cuslog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	colorRed     = 31
+	colorYellow  = 33
+	colorBlue    = 34
+	colorMagenta = 35
+	colorGray    = 37
+)
+
+var levelColors = map[Level]int{
+	TraceLevel: colorGray,
+	DebugLevel: colorGray,
+	InfoLevel:  colorBlue,
+	WarnLevel:  colorYellow,
+	ErrorLevel: colorRed,
+	PanicLevel: colorMagenta,
+	FatalLevel: colorMagenta,
+}
+
+// ConsoleFormatter renders entries in aligned columns for humans, with a
+// colored level name when writing to a terminal.
+type ConsoleFormatter struct {
+	IgnoreBasicFields bool
+	// Out is checked for being a terminal, if nil the output or sink
+	// writer each entry is formatted for.
+	Out           io.Writer
+	ForceColors   bool
+	DisableColors bool
+	// CallerWidth pads the caller column, 24 if zero.
+	CallerWidth      int
+	TimestampFormat  string
+	UTC              bool
+	Location         *time.Location
+	DisableTimestamp bool
+}
+
+func (f *ConsoleFormatter) Format(e *Entry) error {
+	// checked once per entry, isTerminal may stat the output
+	colored := f.colored(e)
+	if !f.IgnoreBasicFields {
+		if !f.DisableTimestamp {
+			e.Buffer.WriteString(formatTime(e.Time, f.TimestampFormat, f.UTC, f.Location))
+			e.Buffer.WriteByte(' ')
+		}
+		f.writeLevel(e, colored)
+		if e.Name != "" {
+			e.Buffer.WriteByte(' ')
+			e.Buffer.WriteString(e.Name)
+		}
+		if e.File != "" {
+			width := f.CallerWidth
+			if width == 0 {
+				width = 24
+			}
+			fmt.Fprintf(e.Buffer, " %-*s", width, e.callerFile(true)+":"+strconv.Itoa(e.Line))
+		}
+		e.Buffer.WriteByte(' ')
+	}
+
+	e.Buffer.WriteString(e.Msg())
+	for _, k := range sortedKeys(e.Map) {
+		e.Buffer.WriteByte(' ')
+		colorize(e, colored, colorGray, k+"=")
+		v := fmt.Sprint(e.Map[k])
+		if needsQuoting(v) {
+			v = strconv.Quote(v)
+		}
+		e.Buffer.WriteString(v)
+	}
+	for _, field := range e.TypedFields {
+		if field.Type == SkipType {
+			continue
+		}
+		e.Buffer.WriteByte(' ')
+		colorize(e, colored, colorGray, field.Key+"=")
+		e.Buffer.Write(field.appendTextValue(e.scratch[:0]))
+	}
+	e.Buffer.WriteByte('\n')
+	e.Buffer.Write(appendTextStack(e.scratch[:0], e.Stack))
+
+	return nil
+}
+
+func (f *ConsoleFormatter) writeLevel(e *Entry, colored bool) {
+	name := fmt.Sprintf("%-5s", e.Level.String())
+	color, ok := levelColors[e.Level]
+	if !ok {
+		color = colorGray
+	}
+	colorize(e, colored, color, name)
+}
+
+func colorize(e *Entry, colored bool, color int, s string) {
+	if !colored {
+		e.Buffer.WriteString(s)
+		return
+	}
+	fmt.Fprintf(e.Buffer, "\x1b[%dm%s\x1b[0m", color, s)
+}
+
+func (f *ConsoleFormatter) colored(e *Entry) bool {
+	if f.DisableColors {
+		return false
+	}
+	if f.ForceColors {
+		return true
+	}
+	out := f.Out
+	if out == nil {
+		out = e.out
+	}
+	return isTerminal(out)
+}
+
+// perDestination reports whether the output of f depends on the writer it
+// is formatted for, so that it can't be shared by sinks.
+func (f *ConsoleFormatter) perDestination() bool {
+	return f.Out == nil && !f.ForceColors && !f.DisableColors
+}
+
+// terminals caches whether stdout and stderr, the usual outputs, are
+// terminals. Other files are checked on each entry.
+var terminals sync.Map // *os.File -> bool
+
+func isTerminal(w io.Writer) bool {
+	fd, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	if terminal, ok := terminals.Load(fd); ok {
+		return terminal.(bool)
+	}
+	info, err := fd.Stat()
+	terminal := err == nil && info.Mode()&os.ModeCharDevice != 0
+	if fd == os.Stdout || fd == os.Stderr {
+		terminals.Store(fd, terminal)
+	}
+	return terminal
+}
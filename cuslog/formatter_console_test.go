@@ -0,0 +1,49 @@
+package cuslog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// /dev/null is a character device, which isTerminal takes for a terminal.
+func openCharDevice(t *testing.T) *os.File {
+	t.Helper()
+	f, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+func TestConsoleFormatterColorsPerSink(t *testing.T) {
+	tty := openCharDevice(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	console := &ConsoleFormatter{DisableTimestamp: true}
+	l := New(WithOutput(tty), WithFormatter(console), WithDisableCaller(true),
+		WithSinks(Sink{Writer: tty}, Sink{Writer: file}))
+	l.Warn("disk full")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "WARN  disk full\n" {
+		t.Errorf("file sink got %q, want no colors", got)
+	}
+
+	e := entry(l)
+	e.Level, e.Message, e.out = WarnLevel, "disk full", tty
+	_ = console.Format(e)
+	if got := e.Buffer.String(); !strings.HasPrefix(got, "\x1b[33mWARN \x1b[0m") {
+		t.Errorf("terminal got %q, want a colored level", got)
+	}
+}
@@ -10,25 +10,87 @@ import (
 
 type JsonFormatter struct {
 	IgnoreBasicFields bool
+	TimestampFormat   string
+	UTC               bool
+	Location          *time.Location
+	DisableTimestamp  bool
+	// FieldMap renames the basic fields.
+	FieldMap FieldMap
 }
 
 func (f *JsonFormatter) Format(e *Entry) error {
 	if !f.IgnoreBasicFields {
-		e.Map["level"] = LevelNameMapping[e.Level]
-		e.Map["time"] = e.Time.Format(time.RFC3339)
+		// keys of the basic fields, which fields of the same key can't replace
+		var basic [7]string
+		nb := 0
+		key := func(buf []byte, k, def string) []byte {
+			basic[nb] = f.FieldMap.resolve(k, def)
+			nb++
+			return appendJSONKey(buf, basic[nb-1])
+		}
+
+		buf := append(e.scratch[:0], '{')
+		buf = key(buf, FieldKeyLevel, "level")
+		buf = appendJSONString(buf, e.Level.String())
+		if e.Name != "" {
+			buf = key(buf, FieldKeyName, "logger")
+			buf = appendJSONString(buf, e.Name)
+		}
+		if !f.DisableTimestamp {
+			buf = key(buf, FieldKeyTime, "time")
+			buf = append(buf, '"')
+			buf = appendTime(buf, e.Time, f.TimestampFormat, f.UTC, f.Location)
+			buf = append(buf, '"')
+		}
 		if e.File != "" {
-			e.Map["file"] = e.File + ":" + strconv.Itoa(e.Line)
-			e.Map["func"] = e.Func
+			buf = key(buf, FieldKeyFile, "file")
+			buf = append(buf, '"')
+			buf = appendJSONEscaped(buf, e.callerFile(false))
+			buf = append(buf, ':')
+			buf = strconv.AppendInt(buf, int64(e.Line), 10)
+			buf = append(buf, '"')
+			if e.Func != "" {
+				buf = key(buf, FieldKeyFunc, "func")
+				buf = appendJSONString(buf, e.Func)
+			}
+		}
+		buf = key(buf, FieldKeyMsg, "message")
+		buf = appendJSONString(buf, e.Msg())
+		if e.Stack != "" {
+			buf = key(buf, FieldKeyStacktrace, "stacktrace")
+			buf = appendJSONString(buf, e.Stack)
 		}
 
-		switch e.Format {
-		case FmtEmptySeparate:
-			e.Map["message"] = fmt.Sprint(e.Args...)
-		default:
-			e.Map["message"] = fmt.Sprintf(e.Format, e.Args...)
+		fieldKey := func(buf []byte, k string) []byte {
+			for _, b := range basic[:nb] {
+				if b == k {
+					// e.g. a "level" field, keep the level of the entry
+					return appendJSONKey(buf, "fields."+k)
+				}
+			}
+			return appendJSONKey(buf, k)
 		}
+		if len(e.Map) > 0 {
+			for _, k := range sortedKeys(e.Map) {
+				if hasTypedField(e.TypedFields, k) {
+					continue // the typed field wins
+				}
+				buf = fieldKey(buf, k)
+				buf = appendJSONValue(buf, e.Map[k])
+			}
+		}
+		for i, field := range e.TypedFields {
+			if field.Type == SkipType || hasTypedField(e.TypedFields[i+1:], field.Key) {
+				continue // the last field of a key wins
+			}
+			buf = fieldKey(buf, field.Key)
+			buf = field.appendJSON(buf)
+		}
+		buf = append(buf, '}', '\n')
 
-		return jsoniter.NewEncoder(e.Buffer).Encode(e.Map)
+		e.scratch = buf
+		_, err := e.Buffer.Write(buf)
+		return err
 	}
 
 	switch e.Format {
@@ -44,3 +106,13 @@ func (f *JsonFormatter) Format(e *Entry) error {
 
 	return nil
 }
+
+// hasTypedField reports whether fields has a field of key.
+func hasTypedField(fields []Field, key string) bool {
+	for i := range fields {
+		if fields[i].Key == key && fields[i].Type != SkipType {
+			return true
+		}
+	}
+	return false
+}
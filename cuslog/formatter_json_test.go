@@ -0,0 +1,33 @@
+package cuslog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestJsonFormatterDuplicateKeys(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(WithOutput(&buf), WithFormatter(&JsonFormatter{DisableTimestamp: true}), WithDisableCaller(true))
+	l.WithField("message", "x").WithField("user", "map").
+		With(String("user", "with"), Int("n", 1)).
+		Infow("hi", String("level", "z"), Int("n", 2))
+
+	want := `{"level":"INFO","message":"hi","fields.message":"x","user":"with","fields.level":"z","n":2}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got  %s want %s", got, want)
+	}
+	if m := decodeLines(t, &buf)[0]; m["level"] != "INFO" || m["message"] != "hi" {
+		t.Errorf("decoded %v", m)
+	}
+}
+
+func TestJsonFormatterRenamedBasicKeys(t *testing.T) {
+	var buf bytes.Buffer
+	f := &JsonFormatter{DisableTimestamp: true, FieldMap: FieldMap{FieldKeyMsg: "msg"}}
+	l := New(WithOutput(&buf), WithFormatter(f), WithDisableCaller(true))
+	l.Infow("hi", String("msg", "field"), String("message", "kept"))
+	if got := buf.String(); !strings.Contains(got, `"msg":"hi","fields.msg":"field","message":"kept"`) {
+		t.Errorf("got %s", got)
+	}
+}
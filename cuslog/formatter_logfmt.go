@@ -0,0 +1,125 @@
+package cuslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// LogfmtFormatter renders entries as logfmt key=value lines, quoting and
+// escaping keys and values where needed.
+type LogfmtFormatter struct {
+	IgnoreBasicFields bool
+	TimestampFormat   string
+	UTC               bool
+	Location          *time.Location
+	DisableTimestamp  bool
+	// FieldMap renames the basic fields, FieldKeyFile is rendered as
+	// "caller" and FieldKeyMsg as "msg" by default.
+	FieldMap FieldMap
+}
+
+func (f *LogfmtFormatter) Format(e *Entry) error {
+	if !f.IgnoreBasicFields {
+		if !f.DisableTimestamp {
+			writeLogfmtPair(e, f.FieldMap.resolve(FieldKeyTime, "time"), formatTime(e.Time, f.TimestampFormat, f.UTC, f.Location))
+		}
+		writeLogfmtPair(e, f.FieldMap.resolve(FieldKeyLevel, "level"), strings.ToLower(e.Level.String()))
+		if e.Name != "" {
+			writeLogfmtPair(e, f.FieldMap.resolve(FieldKeyName, "logger"), e.Name)
+		}
+		if e.File != "" {
+			writeLogfmtPair(e, f.FieldMap.resolve(FieldKeyFile, "caller"), e.callerFile(true)+":"+strconv.Itoa(e.Line))
+			if e.Func != "" {
+				writeLogfmtPair(e, f.FieldMap.resolve(FieldKeyFunc, "func"), e.Func)
+			}
+		}
+	}
+	writeLogfmtPair(e, f.FieldMap.resolve(FieldKeyMsg, "msg"), e.Msg())
+	for _, k := range sortedKeys(e.Map) {
+		v := e.Map[k]
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		writeLogfmtPair(e, k, fmt.Sprint(v))
+	}
+	for _, field := range e.TypedFields {
+		if field.Type == SkipType {
+			continue
+		}
+		writeLogfmtPair(e, field.Key, string(field.appendText(e.scratch[:0])))
+	}
+	if e.Stack != "" {
+		writeLogfmtPair(e, f.FieldMap.resolve(FieldKeyStacktrace, "stacktrace"), e.Stack)
+	}
+	e.Buffer.WriteString("\n")
+
+	return nil
+}
+
+func writeLogfmtPair(e *Entry, key, value string) {
+	if e.Buffer.Len() > 0 {
+		e.Buffer.WriteByte(' ')
+	}
+	writeLogfmtKey(e, key)
+	e.Buffer.WriteByte('=')
+	writeLogfmtValue(e, value)
+}
+
+// writeLogfmtKey writes key with the characters not allowed in a logfmt
+// key replaced by '_'.
+func writeLogfmtKey(e *Entry, key string) {
+	if key == "" {
+		e.Buffer.WriteByte('_')
+		return
+	}
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			r = '_'
+		}
+		e.Buffer.WriteRune(r)
+	}
+}
+
+func writeLogfmtValue(e *Entry, value string) {
+	if !logfmtNeedsQuoting(value) {
+		e.Buffer.WriteString(value)
+		return
+	}
+
+	e.Buffer.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '\\', '"':
+			e.Buffer.WriteByte('\\')
+			e.Buffer.WriteRune(r)
+		case '\n':
+			e.Buffer.WriteString(`\n`)
+		case '\r':
+			e.Buffer.WriteString(`\r`)
+		case '\t':
+			e.Buffer.WriteString(`\t`)
+		default:
+			if r < ' ' || r == 0x7f {
+				fmt.Fprintf(e.Buffer, `\u%04x`, r)
+				continue
+			}
+			e.Buffer.WriteRune(r)
+		}
+	}
+	e.Buffer.WriteByte('"')
+}
+
+func logfmtNeedsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == 0x7f || r == utf8.RuneError {
+			return true
+		}
+	}
+	return false
+}
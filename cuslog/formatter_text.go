@@ -2,36 +2,91 @@ package cuslog
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type TextFormatter struct {
 	IgnoreBasicFields bool
+	// TimestampFormat is the layout of the time, RFC3339 if empty.
+	TimestampFormat string
+	// UTC renders the time in UTC, Location in the given location.
+	UTC              bool
+	Location         *time.Location
+	DisableTimestamp bool
 }
 
 func (f *TextFormatter) Format(e *Entry) error {
+	buf := e.scratch[:0]
 	if !f.IgnoreBasicFields {
-		e.Buffer.WriteString(fmt.Sprintf("%s %s", e.Time.Format(time.RFC3339), LevelNameMapping[e.Level])) // allocs
+		if !f.DisableTimestamp {
+			buf = appendTime(buf, e.Time, f.TimestampFormat, f.UTC, f.Location)
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, e.Level.String()...)
+		if e.Name != "" {
+			buf = append(buf, ' ')
+			buf = append(buf, e.Name...)
+		}
 		if e.File != "" {
-			short := e.File
-			for i := len(e.File) - 1; i > 0; i-- {
-				if e.File[i] == '/' {
-					short = e.File[i+1:]
-					break
-				}
-			}
-			e.Buffer.WriteString(fmt.Sprintf(" %s:%d", short, e.Line))
+			buf = append(buf, ' ')
+			buf = append(buf, e.callerFile(true)...)
+			buf = append(buf, ':')
+			buf = strconv.AppendInt(buf, int64(e.Line), 10)
+		}
+		buf = append(buf, ' ')
+	}
+
+	buf = append(buf, e.Msg()...)
+	buf = appendTextFields(buf, e)
+	buf = append(buf, '\n')
+	buf = appendTextStack(buf, e.Stack)
+
+	e.scratch = buf
+	_, err := e.Buffer.Write(buf)
+	return err
+}
+
+// appendTextFields appends the entry fields as key=value pairs, the
+// untyped ones sorted by key.
+func appendTextFields(dst []byte, e *Entry) []byte {
+	if len(e.Map) > 0 {
+		for _, k := range sortedKeys(e.Map) {
+			dst = append(dst, ' ')
+			dst = append(dst, k...)
+			dst = append(dst, '=')
+			dst = appendMaybeQuoted(dst, fmt.Sprint(e.Map[k]))
+		}
+	}
+	for _, field := range e.TypedFields {
+		if field.Type == SkipType {
+			continue
 		}
-		e.Buffer.WriteString(" ")
+		dst = append(dst, ' ')
+		dst = append(dst, field.Key...)
+		dst = append(dst, '=')
+		dst = field.appendTextValue(dst)
 	}
+	return dst
+}
 
-	switch e.Format {
-	case FmtEmptySeparate:
-		e.Buffer.WriteString(fmt.Sprint(e.Args...))
-	default:
-		e.Buffer.WriteString(fmt.Sprintf(e.Format, e.Args...))
+// appendTextStack appends stack as a block indented under the entry.
+func appendTextStack(dst []byte, stack string) []byte {
+	if stack == "" {
+		return dst
 	}
-	e.Buffer.WriteString("\n")
+	for _, line := range strings.Split(stack, "\n") {
+		dst = append(dst, "    "...)
+		dst = append(dst, line...)
+		dst = append(dst, '\n')
+	}
+	return dst
+}
 
-	return nil
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	return strings.ContainsAny(s, " =\"\t\r\n")
 }
@@ -2,7 +2,10 @@ module cuslog
 
 go 1.17
 
-require github.com/json-iterator/go v1.1.12
+require (
+	github.com/json-iterator/go v1.1.12
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
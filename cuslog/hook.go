@@ -0,0 +1,30 @@
+package cuslog
+
+import (
+	"fmt"
+	"os"
+)
+
+// Hook is fired for entries of the levels it returns, before the entry is
+// formatted. Fire may add or change fields of the entry.
+type Hook interface {
+	Levels() []Level
+	Fire(*Entry) error
+}
+
+// LevelHooks holds the hooks registered for each level.
+type LevelHooks map[Level][]Hook
+
+func (hooks LevelHooks) Add(hook Hook) {
+	for _, level := range hook.Levels() {
+		hooks[level] = append(hooks[level], hook)
+	}
+}
+
+func (hooks LevelHooks) Fire(e *Entry) {
+	for _, hook := range hooks[e.Level] {
+		if err := hook.Fire(e); err != nil {
+			fmt.Fprintf(os.Stderr, "cuslog: failed to fire hook: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package cuslog
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// AtomicLevel is a level which can be changed safely while logging.
+// Copies share the same underlying level.
+type AtomicLevel struct {
+	l *uint32
+}
+
+func NewAtomicLevel(level Level) AtomicLevel {
+	a := AtomicLevel{l: new(uint32)}
+	a.SetLevel(level)
+	return a
+}
+
+func (a AtomicLevel) Level() Level {
+	return Level(atomic.LoadUint32(a.l))
+}
+
+func (a AtomicLevel) SetLevel(level Level) {
+	atomic.StoreUint32(a.l, uint32(level))
+}
+
+// Enabled reports whether entries of level pass the current level.
+func (a AtomicLevel) Enabled(level Level) bool {
+	return a.Level() <= level
+}
+
+type levelPayload struct {
+	Level *Level `json:"level"`
+}
+
+type errorPayload struct {
+	Error string `json:"error"`
+}
+
+// ServeHTTP serves the level as {"level":"info"} on GET and changes it
+// from a body of the same shape on PUT.
+func (a AtomicLevel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	enc := jsoniter.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req levelPayload
+		if err := jsoniter.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = enc.Encode(errorPayload{Error: err.Error()})
+			return
+		}
+		if req.Level == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = enc.Encode(errorPayload{Error: "must specify a logging level"})
+			return
+		}
+		a.SetLevel(*req.Level)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		_ = enc.Encode(errorPayload{Error: "only GET and PUT are supported"})
+		return
+	}
+
+	level := a.Level()
+	_ = enc.Encode(levelPayload{Level: &level})
+}
@@ -0,0 +1,40 @@
+package cuslog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAtomicLevelServeHTTP(t *testing.T) {
+	tests := []struct {
+		method, body string
+		status       int
+		response     string
+		level        Level
+	}{
+		{http.MethodGet, "", http.StatusOK, `{"level":"info"}`, InfoLevel},
+		{http.MethodPut, `{"level":"warn"}`, http.StatusOK, `{"level":"warn"}`, WarnLevel},
+		{http.MethodPut, `{"level":"loud"}`, http.StatusBadRequest, `{"error":`, InfoLevel},
+		{http.MethodPut, `{}`, http.StatusBadRequest, `{"error":"must specify a logging level"}`, InfoLevel},
+		{http.MethodPut, `not json`, http.StatusBadRequest, `{"error":`, InfoLevel},
+		{http.MethodPost, `{"level":"warn"}`, http.StatusMethodNotAllowed, `{"error":"only GET and PUT are supported"}`, InfoLevel},
+		{http.MethodDelete, "", http.StatusMethodNotAllowed, `{"error":"only GET and PUT are supported"}`, InfoLevel},
+	}
+	for _, tt := range tests {
+		a := NewAtomicLevel(InfoLevel)
+		rec := httptest.NewRecorder()
+		a.ServeHTTP(rec, httptest.NewRequest(tt.method, "/level", strings.NewReader(tt.body)))
+
+		if rec.Code != tt.status || !strings.HasPrefix(rec.Body.String(), tt.response) {
+			t.Errorf("%s %s: %d %s, want %d %s", tt.method, tt.body, rec.Code, rec.Body.String(), tt.status, tt.response)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s: content type %q", tt.method, tt.body, ct)
+		}
+		if a.Level() != tt.level {
+			t.Errorf("%s %s: level %v, want %v", tt.method, tt.body, a.Level(), tt.level)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package cuslog
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// alertLevel is registered once for the package tests, the registry is
+// global.
+const alertLevel Level = 35
+
+func init() {
+	if err := RegisterLevel(alertLevel, "ALERT"); err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterLevel(t *testing.T) {
+	want := []Level{TraceLevel, DebugLevel, InfoLevel, WarnLevel, alertLevel, ErrorLevel, PanicLevel, FatalLevel}
+	if !reflect.DeepEqual(AllLevels, want) {
+		t.Errorf("AllLevels = %v, want %v", AllLevels, want)
+	}
+	if alertLevel.String() != "ALERT" {
+		t.Errorf("String() = %s", alertLevel)
+	}
+
+	for _, tt := range []struct {
+		level Level
+		name  string
+	}{{36, "alert"}, {alertLevel, "SIREN"}, {WarnLevel, "CAUTION"}, {37, ""}} {
+		if err := RegisterLevel(tt.level, tt.name); err == nil {
+			t.Errorf("RegisterLevel(%d, %q) succeeded", tt.level, tt.name)
+		}
+	}
+	if !reflect.DeepEqual(AllLevels, want) || LevelNameMapping[36] != "" {
+		t.Errorf("failed registrations changed the levels to %v", AllLevels)
+	}
+}
+
+func TestUnmarshalRegisteredLevel(t *testing.T) {
+	for _, text := range []string{"ALERT", "alert", "Alert"} {
+		var level Level
+		if err := level.UnmarshalText([]byte(text)); err != nil || level != alertLevel {
+			t.Errorf("UnmarshalText(%q) = %v, %v", text, level, err)
+		}
+	}
+	var level Level
+	if err := level.UnmarshalText([]byte("siren")); err == nil {
+		t.Errorf("UnmarshalText(siren) = %v, want an error", level)
+	}
+	if text, _ := alertLevel.MarshalText(); string(text) != "alert" {
+		t.Errorf("MarshalText() = %s", text)
+	}
+}
+
+func TestWithLevelEnabled(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(WithOutput(&buf), WithFormatter(&JsonFormatter{DisableTimestamp: true}), WithDisableCaller(true),
+		WithLevel(ErrorLevel), WithLevelEnabled(alertLevel, true), WithLevelEnabled(FatalLevel, false))
+	l.Warn("warn")
+	l.Log(alertLevel, "alert")
+	l.Error("error")
+	l.Named("db").Log(alertLevel, "named alert")
+
+	want := [][2]string{{"ALERT", "alert"}, {"ERROR", "error"}, {"ALERT", "named alert"}}
+	entries := decodeLines(t, &buf)
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e["level"] != want[i][0] || e["message"] != want[i][1] {
+			t.Errorf("entry %d = %v %v, want %s %s", i, e["level"], e["message"], want[i][0], want[i][1])
+		}
+	}
+	if l.enabled(l.opt(), FatalLevel) {
+		t.Error("FATAL enabled, want disabled by WithLevelEnabled")
+	}
+}
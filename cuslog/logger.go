@@ -1,59 +1,345 @@
 package cuslog
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"os"
 	"sync"
-	"unsafe"
+	"sync/atomic"
 )
 
-var std = New()
+// Logger is the logging API of cuslog, implemented by the loggers returned
+// by New and their children.
+type Logger interface {
+	Trace(args ...interface{})
+	Debug(args ...interface{})
+	Info(args ...interface{})
+	Warn(args ...interface{})
+	Error(args ...interface{})
+	Panic(args ...interface{})
+	Fatal(args ...interface{})
+
+	Tracef(format string, args ...interface{})
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	Panicf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+
+	Tracew(msg string, fields ...Field)
+	Debugw(msg string, fields ...Field)
+	Infow(msg string, fields ...Field)
+	Warnw(msg string, fields ...Field)
+	Errorw(msg string, fields ...Field)
+	Panicw(msg string, fields ...Field)
+	Fatalw(msg string, fields ...Field)
+
+	// Log, Logf and Logw log at level, e.g. a custom level, and don't
+	// panic or exit at PanicLevel and FatalLevel.
+	Log(level Level, args ...interface{})
+	Logf(level Level, format string, args ...interface{})
+	Logw(level Level, msg string, fields ...Field)
+
+	WithField(key string, value interface{}) Logger
+	WithFields(fields Fields) Logger
+	With(fields ...Field) Logger
+	WithContext(ctx context.Context) Logger
+	Named(name string) Logger
+	WithOptions(opts ...Option) Logger
+}
+
+var _ Logger = (*logger)(nil)
+
+var (
+	globalMu sync.RWMutex
+	std      = New()
+	global   = Logger(std)
+)
 
 type logger struct {
-	opt       *options
-	mu        sync.Mutex
+	opts      *atomic.Value // *options, replaced as a whole by SetOptions
+	mu        *sync.Mutex
 	entryPool *sync.Pool
+	fields    Fields
+	typed     []Field
+	ctx       context.Context
+	name      string
+	resolved  atomic.Value // *resolvedLevel of name
 }
 
 func New(opts ...Option) *logger {
-	logger := &logger{opt: initOptions(opts...)}
+	return newLogger(initOptions(opts...), new(sync.Mutex))
+}
+
+func newLogger(opt *options, mu *sync.Mutex) *logger {
+	opts := new(atomic.Value)
+	opts.Store(opt)
+	return newChild(opts, mu)
+}
+
+func newChild(opts *atomic.Value, mu *sync.Mutex) *logger {
+	logger := &logger{opts: opts, mu: mu}
 	logger.entryPool = &sync.Pool{New: func() interface{} { return entry(logger) }}
 	return logger
 }
 
+// clone returns a child logger sharing options and output lock with l.
+func (l *logger) clone() *logger {
+	c := newChild(l.opts, l.mu)
+	c.fields, c.typed, c.ctx, c.name = l.fields, l.typed, l.ctx, l.name
+	return c
+}
+
+// StdLogger returns the std logger, configured by the package level
+// option functions such as SetOptions.
 func StdLogger() *logger {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
 	return std
 }
 
+// L returns the global logger the package level log functions write to.
+func L() Logger {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return global
+}
+
+// globals returns the global logger, and the same logger as *logger when
+// it is one so the package level functions can log from the right depth.
+func globals() (*logger, Logger) {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	l, _ := global.(*logger)
+	return l, global
+}
+
+// ReplaceGlobals redirects the package level log functions to l and
+// returns a function restoring the previous global logger. When l is a
+// logger created by New it also becomes the std logger.
+func ReplaceGlobals(l Logger) func() {
+	globalMu.Lock()
+	prevStd, prev := std, global
+	global = l
+	if sl, ok := l.(*logger); ok {
+		std = sl
+	}
+	globalMu.Unlock()
+
+	return func() {
+		globalMu.Lock()
+		std, global = prevStd, prev
+		globalMu.Unlock()
+	}
+}
+
+// SetStd replaces the std logger, which is also the global logger.
+func SetStd(l *logger) {
+	ReplaceGlobals(l)
+}
+
 func SetOptions(opts ...Option) {
-	std.SetOptions(opts...)
+	StdLogger().SetOptions(opts...)
 }
 
+// SetOptions applies opts to a copy of the options of l and its children,
+// which then replaces them at once: an entry is logged with either the
+// old or the new options. A replaced async writer is closed once the
+// entries logged with the old options are written.
 func (l *logger) SetOptions(opts ...Option) {
+	_, _ = l.replaceOptions(opts...)
+}
+
+// replaceOptions is SetOptions returning the replaced options, and the
+// error of closing the replaced async writer. It must not be called while
+// logging, e.g. from a hook, as it waits for the entries in flight.
+func (l *logger) replaceOptions(opts ...Option) (*options, error) {
+	l.mu.Lock()
+	old := l.opt()
+	o := old.copy()
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.setupAsync()
+	l.opts.Store(o)
+	l.mu.Unlock()
+
+	if old.async != nil && old.async != o.async {
+		old.drain()
+		if atomic.AddInt32(&old.async.holders, -1) > 0 {
+			// still used by a logger derived with WithOptions
+			return old, old.async.Flush()
+		}
+		return old, old.async.Close()
+	}
+	return old, nil
+}
+
+func WithOptions(opts ...Option) Logger {
+	return L().WithOptions(opts...)
+}
+
+// WithOptions returns a child logger with its own copy of the options of
+// l with opts applied, e.g. AddCallerSkip(1) for a logger used through a
+// wrapper, leaving l and its other children unchanged. Later changes of
+// the options of l, including its level, don't reach the child. The
+// child shares the async writer of l if it keeps the same async settings,
+// which is closed once neither of them uses it.
+func (l *logger) WithOptions(opts ...Option) Logger {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	o := l.opt().copy()
+	o.level = NewAtomicLevel(o.level.Level())
 	for _, opt := range opts {
-		opt(l.opt)
+		opt(o)
+	}
+	o.setupAsync()
+	if o.async != nil && o.async == l.opt().async {
+		atomic.AddInt32(&o.async.holders, 1)
+	}
+
+	c := l.clone()
+	c.opts = new(atomic.Value)
+	c.opts.Store(o)
+	return c
+}
+
+func (l *logger) opt() *options {
+	return l.opts.Load().(*options)
+}
+
+func SetLevel(level Level) {
+	StdLogger().SetLevel(level)
+}
+
+func GetLevel() Level {
+	return StdLogger().Level()
+}
+
+func (l *logger) SetLevel(level Level) {
+	l.opt().level.SetLevel(level)
+}
+
+func (l *logger) Level() Level {
+	return l.opt().level.Level()
+}
+
+// AtomicLevel returns the level of l, which also serves as an http.Handler
+// to read and change it at runtime.
+func (l *logger) AtomicLevel() AtomicLevel {
+	return l.opt().level
+}
+
+func Flush() error {
+	return StdLogger().Flush()
+}
+
+func Close() error {
+	return StdLogger().Close()
+}
+
+// Flush reports the entries suppressed by sampling and blocks until all
+// entries queued in async mode, or by sinks writing through an
+// AsyncWriter, have been written.
+func (l *logger) Flush() error {
+	if s := l.opt().sampler; s != nil {
+		l.reportPending(s)
+	}
+	if w := l.opt().async; w != nil {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	for _, s := range l.opt().sinks {
+		if w, ok := s.Writer.(interface{ Flush() error }); ok {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close drains the async queue and switches the logger back to
+// synchronous writes. The output itself is not closed.
+func (l *logger) Close() error {
+	if l.opt().async == nil {
+		return nil
 	}
+	_, err := l.replaceOptions(func(o *options) { o.asyncSize = 0 })
+	return err
+}
+
+// Dropped returns the number of entries discarded by the async queue.
+func (l *logger) Dropped() uint64 {
+	if w := l.opt().async; w != nil {
+		return w.Dropped()
+	}
+	return 0
 }
 
 func Writer() io.Writer {
-	return std
+	return StdLogger()
 }
 
 func (l *logger) Writer() io.Writer {
 	return l
 }
 
+// Write logs each line of data at the std level, or at the level found in
+// its prefix with WithStdLevelDetection, so that the logger can be the
+// output of the log package, gin or sarama. A final line without newline
+// is logged as is.
 func (l *logger) Write(data []byte) (int, error) {
-	l.entry().write(l.opt.stdLevel, FmtEmptySeparate, *(*string)(unsafe.Pointer(&data)))
-	return 0, nil
+	o := l.opt()
+	for rest := data; len(rest) > 0; {
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line, rest = rest[:i], rest[i+1:]
+		} else {
+			rest = nil
+		}
+		line = bytes.TrimRight(line, "\r")
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		level := o.stdLevel
+		if o.stdDetect {
+			if detected, msg, ok := detectLevel(line); ok {
+				level, line = detected, msg
+			}
+		}
+		// data may be reused by the caller, copy it
+		l.entry().write(level, FmtEmptySeparate, string(line))
+	}
+	return len(data), nil
 }
 
 func (l *logger) entry() *Entry {
-	return l.entryPool.Get().(*Entry)
+	e := l.entryPool.Get().(*Entry)
+	e.opt, e.Name = l.acquire(), l.name
+	return e
+}
+
+// acquire returns the options of l, counted in use until the entry logged
+// with them is released.
+func (l *logger) acquire() *options {
+	for {
+		o := l.opt()
+		atomic.AddInt64(o.inflight, 1)
+		if l.opts.Load() == o {
+			return o
+		}
+		// replaced in between, its outputs may be closed already
+		atomic.AddInt64(o.inflight, -1)
+	}
+}
+
+func (l *logger) Trace(args ...interface{}) {
+	l.entry().write(TraceLevel, FmtEmptySeparate, args...)
 }
 
 func (l *logger) Debug(args ...interface{}) {
@@ -74,12 +360,17 @@ func (l *logger) Error(args ...interface{}) {
 
 func (l *logger) Panic(args ...interface{}) {
 	l.entry().write(PanicLevel, FmtEmptySeparate, args...)
+	_ = l.Sync()
 	panic(fmt.Sprint(args...))
 }
 
 func (l *logger) Fatal(args ...interface{}) {
 	l.entry().write(FatalLevel, FmtEmptySeparate, args...)
-	os.Exit(1)
+	l.exit(1)
+}
+
+func (l *logger) Tracef(format string, args ...interface{}) {
+	l.entry().write(TraceLevel, format, args...)
 }
 
 func (l *logger) Debugf(format string, args ...interface{}) {
@@ -100,63 +391,280 @@ func (l *logger) Errorf(format string, args ...interface{}) {
 
 func (l *logger) Panicf(format string, args ...interface{}) {
 	l.entry().write(PanicLevel, format, args...)
+	_ = l.Sync()
 	panic(fmt.Sprintf(format, args...))
 }
 
 func (l *logger) Fatalf(format string, args ...interface{}) {
 	l.entry().write(FatalLevel, format, args...)
-	os.Exit(1)
+	l.exit(1)
+}
+
+func (l *logger) Tracew(msg string, fields ...Field) {
+	l.entry().writew(TraceLevel, msg, fields)
+}
+
+func (l *logger) Debugw(msg string, fields ...Field) {
+	l.entry().writew(DebugLevel, msg, fields)
+}
+
+func (l *logger) Infow(msg string, fields ...Field) {
+	l.entry().writew(InfoLevel, msg, fields)
+}
+
+func (l *logger) Warnw(msg string, fields ...Field) {
+	l.entry().writew(WarnLevel, msg, fields)
+}
+
+func (l *logger) Errorw(msg string, fields ...Field) {
+	l.entry().writew(ErrorLevel, msg, fields)
+}
+
+func (l *logger) Panicw(msg string, fields ...Field) {
+	l.entry().writew(PanicLevel, msg, fields)
+	_ = l.Sync()
+	panic(msg)
+}
+
+func (l *logger) Fatalw(msg string, fields ...Field) {
+	l.entry().writew(FatalLevel, msg, fields)
+	l.exit(1)
+}
+
+func (l *logger) Log(level Level, args ...interface{}) {
+	l.entry().write(level, FmtEmptySeparate, args...)
+}
+
+func (l *logger) Logf(level Level, format string, args ...interface{}) {
+	l.entry().write(level, format, args...)
+}
+
+func (l *logger) Logw(level Level, msg string, fields ...Field) {
+	l.entry().writew(level, msg, fields)
+}
+
+// global logger
+func Trace(args ...interface{}) {
+	l, g := globals()
+	if l == nil {
+		g.Trace(args...)
+		return
+	}
+	l.entry().write(TraceLevel, FmtEmptySeparate, args...)
 }
 
-// std logger
 func Debug(args ...interface{}) {
-	std.entry().write(DebugLevel, FmtEmptySeparate, args...)
+	l, g := globals()
+	if l == nil {
+		g.Debug(args...)
+		return
+	}
+	l.entry().write(DebugLevel, FmtEmptySeparate, args...)
 }
 
 func Info(args ...interface{}) {
-	std.entry().write(InfoLevel, FmtEmptySeparate, args...)
+	l, g := globals()
+	if l == nil {
+		g.Info(args...)
+		return
+	}
+	l.entry().write(InfoLevel, FmtEmptySeparate, args...)
 }
 
 func Warn(args ...interface{}) {
-	std.entry().write(WarnLevel, FmtEmptySeparate, args...)
+	l, g := globals()
+	if l == nil {
+		g.Warn(args...)
+		return
+	}
+	l.entry().write(WarnLevel, FmtEmptySeparate, args...)
 }
 
 func Error(args ...interface{}) {
-	std.entry().write(ErrorLevel, FmtEmptySeparate, args...)
+	l, g := globals()
+	if l == nil {
+		g.Error(args...)
+		return
+	}
+	l.entry().write(ErrorLevel, FmtEmptySeparate, args...)
 }
 
 func Panic(args ...interface{}) {
-	std.entry().write(PanicLevel, FmtEmptySeparate, args...)
+	l, g := globals()
+	if l == nil {
+		g.Panic(args...)
+		return
+	}
+	l.entry().write(PanicLevel, FmtEmptySeparate, args...)
+	_ = l.Sync()
 	panic(fmt.Sprint(args...))
 }
 
 func Fatal(args ...interface{}) {
-	std.entry().write(FatalLevel, FmtEmptySeparate, args...)
-	os.Exit(1)
+	l, g := globals()
+	if l == nil {
+		g.Fatal(args...)
+		return
+	}
+	l.entry().write(FatalLevel, FmtEmptySeparate, args...)
+	l.exit(1)
+}
+
+func Tracef(format string, args ...interface{}) {
+	l, g := globals()
+	if l == nil {
+		g.Tracef(format, args...)
+		return
+	}
+	l.entry().write(TraceLevel, format, args...)
 }
 
 func Debugf(format string, args ...interface{}) {
-	std.entry().write(DebugLevel, format, args...)
+	l, g := globals()
+	if l == nil {
+		g.Debugf(format, args...)
+		return
+	}
+	l.entry().write(DebugLevel, format, args...)
 }
 
 func Infof(format string, args ...interface{}) {
-	std.entry().write(InfoLevel, format, args...)
+	l, g := globals()
+	if l == nil {
+		g.Infof(format, args...)
+		return
+	}
+	l.entry().write(InfoLevel, format, args...)
 }
 
 func Warnf(format string, args ...interface{}) {
-	std.entry().write(WarnLevel, format, args...)
+	l, g := globals()
+	if l == nil {
+		g.Warnf(format, args...)
+		return
+	}
+	l.entry().write(WarnLevel, format, args...)
 }
 
 func Errorf(format string, args ...interface{}) {
-	std.entry().write(ErrorLevel, format, args...)
+	l, g := globals()
+	if l == nil {
+		g.Errorf(format, args...)
+		return
+	}
+	l.entry().write(ErrorLevel, format, args...)
 }
 
 func Panicf(format string, args ...interface{}) {
-	std.entry().write(PanicLevel, format, args...)
+	l, g := globals()
+	if l == nil {
+		g.Panicf(format, args...)
+		return
+	}
+	l.entry().write(PanicLevel, format, args...)
+	_ = l.Sync()
 	panic(fmt.Sprintf(format, args...))
 }
 
 func Fatalf(format string, args ...interface{}) {
-	std.entry().write(FatalLevel, format, args...)
-	os.Exit(1)
+	l, g := globals()
+	if l == nil {
+		g.Fatalf(format, args...)
+		return
+	}
+	l.entry().write(FatalLevel, format, args...)
+	l.exit(1)
+}
+
+func Tracew(msg string, fields ...Field) {
+	l, g := globals()
+	if l == nil {
+		g.Tracew(msg, fields...)
+		return
+	}
+	l.entry().writew(TraceLevel, msg, fields)
+}
+
+func Debugw(msg string, fields ...Field) {
+	l, g := globals()
+	if l == nil {
+		g.Debugw(msg, fields...)
+		return
+	}
+	l.entry().writew(DebugLevel, msg, fields)
+}
+
+func Infow(msg string, fields ...Field) {
+	l, g := globals()
+	if l == nil {
+		g.Infow(msg, fields...)
+		return
+	}
+	l.entry().writew(InfoLevel, msg, fields)
+}
+
+func Warnw(msg string, fields ...Field) {
+	l, g := globals()
+	if l == nil {
+		g.Warnw(msg, fields...)
+		return
+	}
+	l.entry().writew(WarnLevel, msg, fields)
+}
+
+func Errorw(msg string, fields ...Field) {
+	l, g := globals()
+	if l == nil {
+		g.Errorw(msg, fields...)
+		return
+	}
+	l.entry().writew(ErrorLevel, msg, fields)
+}
+
+func Panicw(msg string, fields ...Field) {
+	l, g := globals()
+	if l == nil {
+		g.Panicw(msg, fields...)
+		return
+	}
+	l.entry().writew(PanicLevel, msg, fields)
+	_ = l.Sync()
+	panic(msg)
+}
+
+func Fatalw(msg string, fields ...Field) {
+	l, g := globals()
+	if l == nil {
+		g.Fatalw(msg, fields...)
+		return
+	}
+	l.entry().writew(FatalLevel, msg, fields)
+	l.exit(1)
+}
+
+func Log(level Level, args ...interface{}) {
+	l, g := globals()
+	if l == nil {
+		g.Log(level, args...)
+		return
+	}
+	l.entry().write(level, FmtEmptySeparate, args...)
+}
+
+func Logf(level Level, format string, args ...interface{}) {
+	l, g := globals()
+	if l == nil {
+		g.Logf(level, format, args...)
+		return
+	}
+	l.entry().write(level, format, args...)
+}
+
+func Logw(level Level, msg string, fields ...Field) {
+	l, g := globals()
+	if l == nil {
+		g.Logw(level, msg, fields...)
+		return
+	}
+	l.entry().writew(level, msg, fields)
 }
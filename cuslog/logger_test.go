@@ -0,0 +1,164 @@
+package cuslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// decodeLines decodes the JSON entries written to buf.
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("decode %q: %v", line, err)
+		}
+		entries = append(entries, m)
+	}
+	return entries
+}
+
+// logThrough logs msg through a wrapper, like a middleware would.
+func logThrough(l Logger, msg string) {
+	l.Info(msg)
+}
+
+func TestWithOptionsCallerSkip(t *testing.T) {
+	var buf bytes.Buffer
+	base := New(WithOutput(&buf), WithFormatter(&JsonFormatter{DisableTimestamp: true}), WithDisableCallerFunc(true))
+	wrapped := base.Named("gin").WithOptions(AddCallerSkip(1))
+
+	_, file, line, _ := runtime.Caller(0)
+	logThrough(wrapped, "wrapped")
+	base.Info("base")
+	base.Named("other").Info("other")
+
+	want := []string{
+		fmt.Sprintf("%s:%d", file, line+1),
+		fmt.Sprintf("%s:%d", file, line+2),
+		fmt.Sprintf("%s:%d", file, line+3),
+	}
+	entries := decodeLines(t, &buf)
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e["file"] != want[i] {
+			t.Errorf("%v: caller %v, want %s", e["message"], e["file"], want[i])
+		}
+	}
+}
+
+func TestWithOptionsKeepsParentAsync(t *testing.T) {
+	var buf, other bytes.Buffer
+	base := New(WithOutput(&buf), WithAsync(16, AsyncBlock), WithDisableCaller(true))
+	child := base.WithOptions(WithOutput(&other), WithAsync(0, AsyncBlock))
+
+	child.Info("child")
+	base.Info("base")
+	if err := base.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if !strings.Contains(buf.String(), "base") || strings.Contains(buf.String(), "child") {
+		t.Errorf("base output %q", buf.String())
+	}
+	if !strings.Contains(other.String(), "child") {
+		t.Errorf("child output %q", other.String())
+	}
+	_ = base.Close()
+}
+
+func TestSetOptionsAsyncKeepsInflightEntries(t *testing.T) {
+	outs := make([]*lockedBuffer, 21)
+	for i := range outs {
+		outs[i] = &lockedBuffer{}
+	}
+	l := New(WithOutput(outs[0]), WithAsync(64, AsyncBlock), WithDisableCaller(true))
+
+	const goroutines, perGoroutine = 4, 500
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				l.Info("line")
+			}
+		}()
+	}
+	for _, out := range outs[1:] {
+		l.SetOptions(WithOutput(out))
+	}
+	wg.Wait()
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := 0
+	for _, out := range outs {
+		lines += strings.Count(out.String(), "\n")
+	}
+	if lines != goroutines*perGoroutine {
+		t.Errorf("got %d lines, want %d", lines, goroutines*perGoroutine)
+	}
+}
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWithOptionsOwnLevel(t *testing.T) {
+	base := New(WithOutput(io.Discard), WithLevel(InfoLevel))
+	child := base.WithOptions(WithLevel(ErrorLevel)).(*logger)
+	if base.Level() != InfoLevel || child.Level() != ErrorLevel {
+		t.Errorf("base %v, child %v, want INFO and ERROR", base.Level(), child.Level())
+	}
+	base.SetLevel(DebugLevel)
+	if child.Level() != ErrorLevel {
+		t.Errorf("child level %v after base.SetLevel, want ERROR", child.Level())
+	}
+}
+
+func TestWithOptionsSharedAsync(t *testing.T) {
+	var out lockedBuffer
+	base := New(WithOutput(&out), WithAsync(16, AsyncBlock), WithDisableCaller(true))
+	child := base.WithOptions(AddCallerSkip(1)).(*logger)
+
+	if err := base.Close(); err != nil {
+		t.Fatal(err)
+	}
+	child.Info("after base closed")
+	if err := child.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "after base closed") {
+		t.Errorf("output %q lacks the child entry", out.String())
+	}
+	w := child.opt().async
+	if err := child.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("x")); err != ErrAsyncClosed {
+		t.Errorf("write to the async writer after both closed: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package cuslog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func Named(name string) Logger {
+	return L().Named(name)
+}
+
+// Named returns a child logger whose entries carry the name of l joined
+// to name with a dot, e.g. kafka.consumer, and which follows the level
+// set for that name by WithNameLevels.
+func (l *logger) Named(name string) Logger {
+	c := l.clone()
+	if l.name != "" && name != "" {
+		c.name = l.name + "." + name
+	} else if name != "" {
+		c.name = name
+	}
+	return c
+}
+
+// Name returns the name of l, empty unless l was created by Named.
+func (l *logger) Name() string {
+	return l.name
+}
+
+// enabled reports whether l logs entries of level with the options o:
+// the levels set by WithLevelEnabled first, then the level of the name of
+// l, then the level of the logger.
+func (l *logger) enabled(o *options, level Level) bool {
+	if len(o.levelEnabled) > 0 {
+		if enabled, ok := o.levelEnabled[level]; ok {
+			return enabled
+		}
+	}
+	if l.name != "" && len(o.nameLevels) > 0 {
+		if min, ok := l.nameLevel(o); ok {
+			return min <= level
+		}
+	}
+	return o.level.Enabled(level)
+}
+
+// nameLevel returns the level set for the name of l, resolved once per
+// options.
+func (l *logger) nameLevel(o *options) (Level, bool) {
+	cached, _ := l.resolved.Load().(*resolvedLevel)
+	if cached == nil || cached.opt != o {
+		cached = &resolvedLevel{opt: o}
+		cached.level, cached.ok = o.nameLevels.resolve(l.name)
+		l.resolved.Store(cached)
+	}
+	return cached.level, cached.ok
+}
+
+type resolvedLevel struct {
+	opt   *options
+	level Level
+	ok    bool
+}
+
+// nameLevels holds levels by logger name pattern, most specific first.
+type nameLevels []nameLevel
+
+type nameLevel struct {
+	pattern string
+	level   Level
+}
+
+func newNameLevels(levels map[string]Level) nameLevels {
+	nl := make(nameLevels, 0, len(levels))
+	for pattern, level := range levels {
+		nl = append(nl, nameLevel{pattern: pattern, level: level})
+	}
+	sort.Slice(nl, func(i, j int) bool {
+		wi, wj := strings.Contains(nl[i].pattern, "*"), strings.Contains(nl[j].pattern, "*")
+		if wi != wj {
+			return !wi
+		}
+		if len(nl[i].pattern) != len(nl[j].pattern) {
+			return len(nl[i].pattern) > len(nl[j].pattern)
+		}
+		return nl[i].pattern < nl[j].pattern
+	})
+	return nl
+}
+
+// resolve returns the level of the most specific pattern matching name:
+// an exact name, else the longest pattern.
+func (nl nameLevels) resolve(name string) (Level, bool) {
+	for _, l := range nl {
+		if matchName(l.pattern, name) {
+			return l.level, true
+		}
+	}
+	return 0, false
+}
+
+// matchName reports whether name matches pattern, in which * stands for
+// any sequence of characters, dots included.
+func matchName(pattern, name string) bool {
+	i := strings.IndexByte(pattern, '*')
+	if i < 0 {
+		return pattern == name
+	}
+	if !strings.HasPrefix(name, pattern[:i]) {
+		return false
+	}
+	rest := pattern[i+1:]
+	for j := i; j <= len(name); j++ {
+		if matchName(rest, name[j:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseNameLevels parses name levels as accepted by WithNameLevels from
+// a comma separated list of pattern=level, e.g.
+// "kafka.*=debug,websocket.hub=warn".
+func ParseNameLevels(s string) (map[string]Level, error) {
+	levels := make(map[string]Level)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		i := strings.LastIndexByte(item, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("cuslog: invalid name level %q", item)
+		}
+		var level Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(item[i+1:]))); err != nil {
+			return nil, err
+		}
+		levels[strings.TrimSpace(item[:i])] = level
+	}
+	return levels, nil
+}
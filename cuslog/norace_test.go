@@ -0,0 +1,6 @@
+//go:build !race
+// +build !race
+
+package cuslog
+
+const raceEnabled = false
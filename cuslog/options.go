@@ -6,16 +6,23 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	FmtEmptySeparate = ""
 )
 
+// Level is the severity of an entry. The built-in levels are spaced so
+// that custom levels registered with RegisterLevel can sit between them.
 type Level uint8
 
-const(
-	DebugLevel Level = iota
+const (
+	TraceLevel Level = iota * 10
+	DebugLevel
 	InfoLevel
 	WarnLevel
 	ErrorLevel
@@ -23,43 +30,74 @@ const(
 	FatalLevel
 )
 
+// AllLevels holds the built-in and registered levels by severity.
+var AllLevels = []Level{TraceLevel, DebugLevel, InfoLevel, WarnLevel, ErrorLevel, PanicLevel, FatalLevel}
+
 var LevelNameMapping = map[Level]string{
-	DebugLevel: "Debug",
-	InfoLevel: "INFO",
-	WarnLevel: "WARN",
+	TraceLevel: "TRACE",
+	DebugLevel: "DEBUG",
+	InfoLevel:  "INFO",
+	WarnLevel:  "WARN",
 	ErrorLevel: "ERROR",
 	PanicLevel: "PANIC",
 	FatalLevel: "FATAL",
 }
 
+// RegisterLevel adds a custom level named name, e.g. RegisterLevel(25,
+// "AUDIT") for a level between info and warn. Levels must be registered
+// before logging, typically from an init function.
+func RegisterLevel(level Level, name string) error {
+	if name == "" {
+		return errors.New("cuslog: empty level name")
+	}
+	for l, n := range LevelNameMapping {
+		if l == level || strings.EqualFold(n, name) {
+			return fmt.Errorf("cuslog: level %d %q is already registered as %d %q", level, name, l, n)
+		}
+	}
+	LevelNameMapping[level] = name
+	i := sort.Search(len(AllLevels), func(i int) bool { return AllLevels[i] > level })
+	AllLevels = append(AllLevels, 0)
+	copy(AllLevels[i+1:], AllLevels[i:])
+	AllLevels[i] = level
+	return nil
+}
+
+func (l Level) String() string {
+	if name, ok := LevelNameMapping[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("Level(%d)", l)
+}
+
+// MarshalText marshals the level to its lowercase name.
+func (l Level) MarshalText() ([]byte, error) {
+	return bytes.ToLower([]byte(l.String())), nil
+}
+
 var errUnmarshalNilLevel = errors.New("can't unmarshal a nil *Level")
 
 func (l *Level) unmarshalText(text []byte) bool {
-	switch string(text) {
-	case "debug", "DEBUG":
-		*l = DebugLevel
-	case "info", "INFO", "": // make the zero value useful
+	if len(text) == 0 { // make the zero value useful
 		*l = InfoLevel
-	case "warn", "WARN":
-		*l = WarnLevel
-	case "error", "ERROR":
-		*l = ErrorLevel
-	case "panic", "PANIC":
-		*l = PanicLevel
-	case "fatal", "FATAL":
-		*l = FatalLevel
-	default:
-		return false
+		return true
+	}
+	for level, name := range LevelNameMapping {
+		if strings.EqualFold(name, string(text)) {
+			*l = level
+			return true
+		}
 	}
-	return true
+	return false
 }
 
-// UnmarshalText unmarshals text to a level.
+// UnmarshalText unmarshals the name of a built-in or registered level,
+// ignoring case.
 func (l *Level) UnmarshalText(text []byte) error {
 	if l == nil {
 		return errUnmarshalNilLevel
 	}
-	if !l.unmarshalText(text) && !l.unmarshalText(bytes.ToLower(text)) {
+	if !l.unmarshalText(text) {
 		return fmt.Errorf("unrecognized level: %q", text)
 	}
 	return nil
@@ -68,16 +106,37 @@ func (l *Level) UnmarshalText(text []byte) error {
 // log options
 type options struct {
 	output        io.Writer
-	level         Level
+	level         AtomicLevel
+	levelEnabled  map[Level]bool
+	nameLevels    nameLevels
 	stdLevel      Level
+	stdDetect     bool
 	formatter     Formatter
 	disableCaller bool
+	disableFunc   bool
+	callerSkip    int
+	callerPath    CallerPath
+
+	ctxExtractors []ContextExtractor
+	hooks         LevelHooks
+	sinks         []Sink
+	sampler       *sampler
+	exitFunc      func(code int)
+	addStack      bool
+	stackLevel    Level
+	redactor      *Redactor
+
+	asyncSize   int
+	asyncPolicy AsyncPolicy
+	async       *AsyncWriter
+
+	inflight *int64 // entries being logged with these options
 }
 
 type Option func(*options)
 
 func initOptions(opts ...Option) (o *options) {
-	o = &options{}
+	o = &options{level: NewAtomicLevel(DebugLevel), stdLevel: DebugLevel, inflight: new(int64)}
 	for _, opt := range opts {
 		opt(o)
 	}
@@ -90,9 +149,63 @@ func initOptions(opts ...Option) (o *options) {
 		o.formatter = &TextFormatter{}
 	}
 
+	o.setupAsync()
+
 	return
 }
 
+// setupAsync replaces the async writer unless it matches the current
+// output and async settings. The replaced writer is left to the caller to
+// close.
+func (o *options) setupAsync() {
+	if o.asyncMatches() {
+		return
+	}
+	o.async = nil
+	if o.asyncSize > 0 {
+		o.async = NewAsyncWriter(o.output, o.asyncSize, o.asyncPolicy)
+		o.async.holders = 1
+	}
+}
+
+// asyncMatches reports whether the async writer matches the current
+// output and async settings.
+func (o *options) asyncMatches() bool {
+	return o.async != nil && o.asyncSize > 0 && o.async.out == o.output &&
+		cap(o.async.queue) == o.asyncSize && o.async.policy == o.asyncPolicy
+}
+
+// copy returns a copy of o whose slices and hooks can be appended to
+// without changing o.
+func (o *options) copy() *options {
+	c := *o
+	c.inflight = new(int64)
+	c.ctxExtractors = o.ctxExtractors[:len(o.ctxExtractors):len(o.ctxExtractors)]
+	if o.hooks != nil {
+		c.hooks = make(LevelHooks, len(o.hooks))
+		for level, hooks := range o.hooks {
+			c.hooks[level] = hooks[:len(hooks):len(hooks)]
+		}
+	}
+	return &c
+}
+
+// drain waits until the entries being logged with o, once replaced, are
+// written, so that its outputs can be closed.
+func (o *options) drain() {
+	for atomic.LoadInt64(o.inflight) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// writer returns the writer entries are written to.
+func (o *options) writer() io.Writer {
+	if o.async != nil {
+		return o.async
+	}
+	return o.output
+}
+
 func WithOutput(output io.Writer) Option {
 	return func(o *options) {
 		o.output = output
@@ -100,6 +213,39 @@ func WithOutput(output io.Writer) Option {
 }
 
 func WithLevel(level Level) Option {
+	return func(o *options) {
+		o.level.SetLevel(level)
+	}
+}
+
+// WithLevelEnabled logs, or drops if not enabled, the entries of level
+// whatever the level of the logger, e.g. to keep an audit level on in
+// production or to silence a chatty one.
+func WithLevelEnabled(level Level, enabled bool) Option {
+	return func(o *options) {
+		m := make(map[Level]bool, len(o.levelEnabled)+1)
+		for l, e := range o.levelEnabled {
+			m[l] = e
+		}
+		m[level] = enabled
+		o.levelEnabled = m
+	}
+}
+
+// WithNameLevels sets the level of the loggers created by Named by name
+// pattern, e.g. {"kafka.*": DebugLevel, "websocket.hub": WarnLevel}, with
+// * matching any characters. An exact name wins over patterns, and longer
+// patterns over shorter ones. Loggers whose name matches no pattern use
+// the level of the logger.
+func WithNameLevels(levels map[string]Level) Option {
+	return func(o *options) {
+		o.nameLevels = newNameLevels(levels)
+	}
+}
+
+// WithAtomicLevel makes the logger use level, so that changing level, e.g.
+// through its http handler, changes the level of the logger.
+func WithAtomicLevel(level AtomicLevel) Option {
 	return func(o *options) {
 		o.level = level
 	}
@@ -111,6 +257,15 @@ func WithStdLevel(level Level) Option {
 	}
 }
 
+// WithStdLevelDetection makes Write log lines at the level of their
+// prefix when it has one, e.g. [WARN], [GIN-debug] or level=error, and at
+// the std level otherwise.
+func WithStdLevelDetection(detect bool) Option {
+	return func(o *options) {
+		o.stdDetect = detect
+	}
+}
+
 func WithFormatter(formatter Formatter) Option {
 	return func(o *options) {
 		o.formatter = formatter
@@ -123,5 +278,116 @@ func WithDisableCaller(caller bool) Option {
 	}
 }
 
+// WithDisableCallerFunc drops the function name from the caller.
+func WithDisableCallerFunc(disable bool) Option {
+	return func(o *options) {
+		o.disableFunc = disable
+	}
+}
+
+// WithCallerSkip sets the number of extra frames skipped to find the
+// caller, for loggers used through n levels of wrapper functions.
+func WithCallerSkip(n int) Option {
+	return func(o *options) {
+		o.callerSkip = n
+	}
+}
+
+// AddCallerSkip adds n to the number of extra frames skipped to find the
+// caller. Use it with WithOptions to derive the logger of a wrapper, as
+// SetOptions also changes the parent and siblings of a child logger.
+func AddCallerSkip(n int) Option {
+	return func(o *options) {
+		o.callerSkip += n
+	}
+}
+
+// CallerPath is how the file of the caller is rendered.
+type CallerPath uint8
+
+const (
+	// CallerPathDefault leaves it to the formatter: the text formatters
+	// render the file name, JsonFormatter the full path.
+	CallerPathDefault CallerPath = iota
+	// CallerPathShort renders the last directory and the file name,
+	// e.g. cuslog/entry.go.
+	CallerPathShort
+	CallerPathFull
+)
+
+func WithCallerPath(path CallerPath) Option {
+	return func(o *options) {
+		o.callerPath = path
+	}
+}
+
+// WithContextExtractors registers extractors whose fields are added to
+// entries of loggers bound to a context with WithContext.
+func WithContextExtractors(extractors ...ContextExtractor) Option {
+	return func(o *options) {
+		o.ctxExtractors = append(o.ctxExtractors, extractors...)
+	}
+}
+
+// WithHooks registers hooks fired before entries of their levels are
+// formatted.
+func WithHooks(hooks ...Hook) Option {
+	return func(o *options) {
+		if o.hooks == nil {
+			o.hooks = make(LevelHooks)
+		}
+		for _, hook := range hooks {
+			o.hooks.Add(hook)
+		}
+	}
+}
+
+// WithSinks replaces the single output with sinks, each one receiving
+// the entries at or above its level rendered by its formatter.
+func WithSinks(sinks ...Sink) Option {
+	return func(o *options) {
+		o.sinks = groupSinks(sinks)
+	}
+}
+
+// WithSampling limits the entries logged per message site, see Sampling.
+// A zero Tick disables sampling.
+func WithSampling(s Sampling) Option {
+	return func(o *options) {
+		o.sampler = newSampler(s)
+	}
+}
+
+// WithExitFunc replaces os.Exit as the function called by Fatal, e.g. to
+// intercept Fatal in tests.
+func WithExitFunc(exit func(code int)) Option {
+	return func(o *options) {
+		o.exitFunc = exit
+	}
+}
+
+// WithStacktraceLevel adds the stack trace to entries at or above level.
+func WithStacktraceLevel(level Level) Option {
+	return func(o *options) {
+		o.addStack, o.stackLevel = true, level
+	}
+}
 
+// WithRedactor masks sensitive data of the entries with r, see Redactor.
+// A nil r disables redaction.
+func WithRedactor(r *Redactor) Option {
+	return func(o *options) {
+		o.redactor = r
+	}
+}
 
+// WithAsync formats entries on the calling goroutine and writes them to
+// the output from a background goroutine through a queue of queueSize
+// entries. Sinks are not affected, wrap their writers with NewAsyncWriter.
+// A queueSize of 0 switches back to synchronous writes.
+func WithAsync(queueSize int, policy AsyncPolicy) Option {
+	return func(o *options) {
+		o.asyncSize = queueSize
+		o.asyncPolicy = policy
+	}
+}
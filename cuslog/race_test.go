@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package cuslog
+
+// raceEnabled skips the allocation checks, the race detector allocates.
+const raceEnabled = true
@@ -0,0 +1,147 @@
+package cuslog
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Redactable is implemented by values that log a masked copy of
+// themselves, e.g. a login request hiding its password.
+type Redactable interface {
+	Redact() interface{}
+}
+
+// Redactor masks sensitive data of entries before they reach the hooks
+// and the formatters: the values of fields whose key, or its last dotted
+// segment, is one of Keys ignoring case, the matches of Patterns in the
+// message and in string fields, and values implementing Redactable.
+type Redactor struct {
+	Keys     []string
+	Patterns []*regexp.Regexp
+	// Cards masks the numbers passing the Luhn check, e.g. payment card
+	// numbers, in the message and in string fields.
+	Cards bool
+	// Mask replaces the redacted data, "***" if empty.
+	Mask string
+}
+
+var (
+	jwtPattern  = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	cardPattern = regexp.MustCompile(`\b[2-6]\d(?:[ -]?\d){11,17}\b`)
+)
+
+// NewRedactor returns a Redactor masking the usual credential keys,
+// JWTs and card numbers.
+func NewRedactor() *Redactor {
+	return &Redactor{
+		Keys: []string{
+			"password", "passwd", "secret", "token", "access_token", "refresh_token",
+			"authorization", "cookie", "api_key", "apikey",
+		},
+		Patterns: []*regexp.Regexp{jwtPattern},
+		Cards:    true,
+	}
+}
+
+func (r *Redactor) redact(e *Entry) {
+	mask := r.mask()
+	for k, v := range e.Map {
+		if r.sensitive(k) {
+			e.Map[k] = mask
+			continue
+		}
+		switch v := v.(type) {
+		case Redactable:
+			e.Map[k] = v.Redact()
+		case string:
+			e.Map[k] = r.redactString(v)
+		}
+	}
+	for i := range e.TypedFields {
+		f := &e.TypedFields[i]
+		switch {
+		case f.Type == SkipType:
+		case r.sensitive(f.Key):
+			*f = String(f.Key, mask)
+		case f.Type == StringType:
+			f.String = r.redactString(f.String)
+		case f.Type == AnyType, f.Type == ErrorType:
+			if v, ok := f.Interface.(Redactable); ok {
+				*f = Any(f.Key, v.Redact())
+			}
+		}
+	}
+
+	if !e.rendered {
+		copied := false
+		for i, arg := range e.Args {
+			if v, ok := arg.(Redactable); ok {
+				// the args may be a slice of the caller
+				if !copied {
+					e.Args, copied = append([]interface{}(nil), e.Args...), true
+				}
+				e.Args[i] = v.Redact()
+			}
+		}
+	}
+	if len(r.Patterns) > 0 || r.Cards {
+		e.Message = r.redactString(e.Msg())
+	}
+}
+
+// sensitive reports whether key, or its last dotted segment for the keys
+// of nested fields such as req.password from slog groups, is one of Keys.
+func (r *Redactor) sensitive(key string) bool {
+	last := key
+	if i := strings.LastIndexByte(key, '.'); i >= 0 {
+		last = key[i+1:]
+	}
+	for _, k := range r.Keys {
+		if strings.EqualFold(k, key) || strings.EqualFold(k, last) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) redactString(s string) string {
+	for _, p := range r.Patterns {
+		s = p.ReplaceAllLiteralString(s, r.mask())
+	}
+	if r.Cards {
+		s = cardPattern.ReplaceAllStringFunc(s, func(m string) string {
+			if luhn(m) {
+				return r.mask()
+			}
+			return m
+		})
+	}
+	return s
+}
+
+func (r *Redactor) mask() string {
+	if r.Mask == "" {
+		return "***"
+	}
+	return r.Mask
+}
+
+// luhn reports whether the digits of s pass the Luhn check.
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
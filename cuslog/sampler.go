@@ -0,0 +1,168 @@
+package cuslog
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Sampling logs the first First entries of each message site per Tick and
+// then every Thereafter-th one, dropping the rest. A site is the level plus
+// the format string (or the message for unformatted calls, rendered when
+// the first argument isn't a string), or the caller file:line when
+// ByCaller is set and caller reporting is enabled.
+// Suppressed entries are reported once per Tick in a summary entry, by
+// the next entry or a timer if none comes, and on Flush and Sync.
+type Sampling struct {
+	Tick       time.Duration
+	First      int
+	Thereafter int
+	ByCaller   bool
+}
+
+const maxSampleSites = 4096
+
+type sampleKey struct {
+	level Level
+	site  string
+	line  int
+}
+
+type sampleCounter struct {
+	resetAt    time.Time
+	n          int
+	suppressed uint64 // since the last summary
+}
+
+type sampleReport struct {
+	key        sampleKey
+	suppressed uint64
+}
+
+type sampler struct {
+	Sampling
+
+	mu         sync.Mutex
+	counters   map[sampleKey]*sampleCounter
+	nextReport time.Time
+	timer      *time.Timer // reports the suppressed entries if no entry does
+}
+
+func newSampler(s Sampling) *sampler {
+	if s.Tick <= 0 {
+		return nil
+	}
+	return &sampler{Sampling: s, counters: make(map[sampleKey]*sampleCounter)}
+}
+
+func (s *sampler) key(e *Entry) sampleKey {
+	if s.ByCaller && e.File != "" {
+		return sampleKey{level: e.Level, site: e.File, line: e.Line}
+	}
+	if e.Format == FmtEmptySeparate {
+		if len(e.Args) == 0 {
+			return sampleKey{level: e.Level, site: e.Message, line: -1}
+		}
+		if msg, ok := e.Args[0].(string); ok {
+			return sampleKey{level: e.Level, site: msg, line: -1}
+		}
+		// e.g. an error, sample by the rendered message
+		return sampleKey{level: e.Level, site: e.Msg(), line: -1}
+	}
+	return sampleKey{level: e.Level, site: e.Format}
+}
+
+// check reports whether e should be logged, plus the sites which had entries
+// suppressed since the previous summary when a summary is due.
+func (s *sampler) check(e *Entry) (bool, []sampleReport) {
+	key := s.key(e)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counters[key]
+	if !ok {
+		if len(s.counters) >= maxSampleSites {
+			s.prune(e.Time)
+		}
+		c = &sampleCounter{resetAt: e.Time.Add(s.Tick)}
+		s.counters[key] = c
+	} else if !e.Time.Before(c.resetAt) {
+		c.resetAt, c.n = e.Time.Add(s.Tick), 0
+	}
+
+	c.n++
+	keep := c.n <= s.First || (s.Thereafter > 0 && (c.n-s.First)%s.Thereafter == 0)
+
+	var reports []sampleReport
+	if !e.Time.Before(s.nextReport) {
+		reports = s.takeReports(e.Time)
+	}
+	if !keep {
+		c.suppressed++
+		if s.timer == nil {
+			l := e.logger
+			s.timer = time.AfterFunc(s.nextReport.Sub(e.Time), func() { l.reportPending(s) })
+		}
+	}
+	return keep, reports
+}
+
+// takeReports returns the sites with suppressed entries and starts a new
+// report period at now. s.mu must be held.
+func (s *sampler) takeReports(now time.Time) []sampleReport {
+	s.nextReport = now.Add(s.Tick)
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	var reports []sampleReport
+	for k, c := range s.counters {
+		if c.suppressed > 0 {
+			reports = append(reports, sampleReport{key: k, suppressed: c.suppressed})
+			c.suppressed = 0
+		}
+	}
+	return reports
+}
+
+// pending returns the sites with suppressed entries not reported yet.
+func (s *sampler) pending(now time.Time) []sampleReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.takeReports(now)
+}
+
+// prune drops the counters whose tick is over and have nothing to report.
+func (s *sampler) prune(now time.Time) {
+	for k, c := range s.counters {
+		if c.suppressed == 0 && !now.Before(c.resetAt) {
+			delete(s.counters, k)
+		}
+	}
+}
+
+// reportPending logs the summaries of the entries suppressed by s, if
+// any, e.g. when the entries stop coming or before exiting.
+func (l *logger) reportPending(s *sampler) {
+	now := time.Now()
+	if reports := s.pending(now); len(reports) > 0 {
+		l.reportSampled(s, reports, now)
+	}
+}
+
+// reportSampled logs a summary entry for each site with suppressed entries.
+func (l *logger) reportSampled(s *sampler, reports []sampleReport, now time.Time) {
+	for _, r := range reports {
+		site := r.key.site
+		if r.key.line > 0 {
+			site += ":" + strconv.Itoa(r.key.line)
+		}
+
+		e := l.entry()
+		e.Time, e.Level = now, r.key.level
+		e.Format = "cuslog: sampled out %d entries of %q in the last %s"
+		e.Args = []interface{}{r.suppressed, site, s.Tick}
+		e.emit()
+	}
+}
@@ -0,0 +1,61 @@
+package cuslog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSampledSummaryOnTimer(t *testing.T) {
+	var out lockedBuffer
+	l := New(WithOutput(&out), WithDisableCaller(true), WithSampling(Sampling{Tick: 20 * time.Millisecond, First: 1}))
+	for i := 0; i < 5; i++ {
+		l.Info("hot")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), "sampled out") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if want := `sampled out 4 entries of "hot"`; !strings.Contains(out.String(), want) {
+		t.Errorf("output %q lacks %q", out.String(), want)
+	}
+}
+
+func TestSampledSummaryOnFlush(t *testing.T) {
+	var out lockedBuffer
+	l := New(WithOutput(&out), WithDisableCaller(true), WithSampling(Sampling{Tick: time.Hour, First: 1}))
+	for i := 0; i < 3; i++ {
+		l.Info("hot")
+	}
+	if strings.Contains(out.String(), "sampled out") {
+		t.Fatalf("summary before the flush: %q", out.String())
+	}
+	if err := l.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := `sampled out 2 entries of "hot"`; !strings.Contains(out.String(), want) {
+		t.Errorf("output %q lacks %q", out.String(), want)
+	}
+}
+
+func TestSamplingNonStringArgs(t *testing.T) {
+	var out lockedBuffer
+	l := New(WithOutput(&out), WithDisableCaller(true), WithSampling(Sampling{Tick: time.Hour, First: 1}))
+	l.Info(errors.New("disk full"))
+	l.Info(errors.New("conn reset"))
+	l.Info(42)
+	l.Info(errors.New("disk full"))
+	if err := l.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"disk full\n", "conn reset\n", "42\n", `sampled out 1 entries of "disk full"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output %q lacks %q", out.String(), want)
+		}
+	}
+	if n := strings.Count(out.String(), "INFO disk full"); n != 1 {
+		t.Errorf("disk full logged %d times, want 1", n)
+	}
+}
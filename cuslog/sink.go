@@ -0,0 +1,77 @@
+package cuslog
+
+import (
+	"io"
+	"reflect"
+)
+
+// Sink is an output with its own minimum level and formatter.
+// A nil Formatter uses the formatter of the logger.
+type Sink struct {
+	Writer    io.Writer
+	Level     Level
+	Formatter Formatter
+
+	group int // sinks sharing a formatter share a group
+}
+
+// EntryWriter is implemented by outputs which take the structured entry
+// instead of its formatted bytes. The entry must not be retained after
+// WriteEntry returns.
+type EntryWriter interface {
+	WriteEntry(e *Entry) error
+}
+
+// entryGroup is the group of sinks writing to an EntryWriter.
+const entryGroup = -1
+
+// groupSinks assigns a group to each sink so entries are formatted once
+// per distinct formatter. Group 0 is the logger formatter.
+func groupSinks(sinks []Sink) []Sink {
+	grouped := make([]Sink, len(sinks))
+	copy(grouped, sinks)
+
+	next := 1
+	for i := range grouped {
+		if _, ok := grouped[i].Writer.(EntryWriter); ok {
+			grouped[i].group = entryGroup
+			continue
+		}
+		if grouped[i].Formatter == nil {
+			grouped[i].group = 0
+			continue
+		}
+
+		group := next
+		for j := 0; j < i; j++ {
+			if grouped[j].group > 0 && sameFormatter(grouped[i].Formatter, grouped[j].Formatter) {
+				group = grouped[j].group
+				break
+			}
+		}
+		if group == next {
+			next++
+		}
+		grouped[i].group = group
+	}
+	return grouped
+}
+
+func sameFormatter(a, b Formatter) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+func (s *Sink) enabled(level Level) bool {
+	return s.Level <= level
+}
+
+func (s *Sink) formatter(o *options) Formatter {
+	if s.Formatter != nil {
+		return s.Formatter
+	}
+	return o.formatter
+}
@@ -0,0 +1,184 @@
+//go:build go1.21
+
+package cuslog
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// SlogHandler is a slog.Handler logging through a cuslog logger, so that
+// slog.New(NewSlogHandler(l)) shares the level, formatters and outputs of l.
+// Attributes become typed fields, groups prefix their keys with "group.".
+type SlogHandler struct {
+	l      *logger
+	prefix string
+}
+
+func NewSlogHandler(l *logger) *SlogHandler {
+	return &SlogHandler{l: l}
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.l.enabled(h.l.opt(), fromSlogLevel(level))
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	e := h.l.entry()
+	e.Time, e.Level, e.Message = r.Time, fromSlogLevel(r.Level), r.Message
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Context = ctx
+	e.TypedFields = append(e.TypedFields, h.l.typed...)
+	r.Attrs(func(a slog.Attr) bool {
+		e.TypedFields = appendAttr(e.TypedFields, h.prefix, a)
+		return true
+	})
+	if !e.opt.disableCaller && r.PC != 0 {
+		e.setCaller(r.PC)
+	}
+	e.dispatch()
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make([]Field, 0, len(attrs))
+	for _, a := range attrs {
+		fields = appendAttr(fields, h.prefix, a)
+	}
+	return &SlogHandler{l: h.l.with(fields), prefix: h.prefix}
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SlogHandler{l: h.l, prefix: h.prefix + name + "."}
+}
+
+// appendAttr appends a as fields, flattening groups into prefixed keys.
+func appendAttr(fields []Field, prefix string, a slog.Attr) []Field {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		group := v.Group()
+		if len(group) == 0 {
+			return fields
+		}
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range group {
+			fields = appendAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+	if a.Key == "" && v.Any() == nil {
+		return fields
+	}
+
+	key := prefix + a.Key
+	switch v.Kind() {
+	case slog.KindString:
+		return append(fields, String(key, v.String()))
+	case slog.KindInt64:
+		return append(fields, Int64(key, v.Int64()))
+	case slog.KindUint64:
+		return append(fields, Uint64(key, v.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, Float64(key, v.Float64()))
+	case slog.KindBool:
+		return append(fields, Bool(key, v.Bool()))
+	case slog.KindDuration:
+		return append(fields, Duration(key, v.Duration()))
+	case slog.KindTime:
+		return append(fields, Time(key, v.Time()))
+	}
+	return append(fields, Any(key, v.Any()))
+}
+
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelDebug:
+		return TraceLevel
+	case level < slog.LevelInfo:
+		return DebugLevel
+	case level < slog.LevelWarn:
+		return InfoLevel
+	case level < slog.LevelError:
+		return WarnLevel
+	}
+	return ErrorLevel
+}
+
+// toSlogLevel maps level, or the built-in level below a custom one, to
+// a slog level.
+func toSlogLevel(level Level) slog.Level {
+	switch {
+	case level < DebugLevel:
+		return slog.LevelDebug - 4
+	case level < InfoLevel:
+		return slog.LevelDebug
+	case level < WarnLevel:
+		return slog.LevelInfo
+	case level < ErrorLevel:
+		return slog.LevelWarn
+	case level < PanicLevel:
+		return slog.LevelError
+	case level < FatalLevel:
+		return slog.LevelError + 4
+	}
+	return slog.LevelError + 8
+}
+
+// SlogWriter is an output handing entries to a slog.Logger, for use with
+// WithOutput or as the Writer of a Sink. Fields become attributes.
+type SlogWriter struct {
+	l *slog.Logger
+}
+
+func NewSlogWriter(l *slog.Logger) *SlogWriter {
+	return &SlogWriter{l: l}
+}
+
+func (w *SlogWriter) WriteEntry(e *Entry) error {
+	ctx := e.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	level := toSlogLevel(e.Level)
+	if !w.l.Enabled(ctx, level) {
+		return nil
+	}
+
+	r := slog.NewRecord(e.Time, level, e.Msg(), e.pc)
+	if e.Name != "" {
+		r.AddAttrs(slog.String(FieldKeyName, e.Name))
+	}
+	for _, k := range sortedKeys(e.Map) {
+		r.AddAttrs(slog.Any(k, e.Map[k]))
+	}
+	for _, f := range e.TypedFields {
+		if f.Type != SkipType {
+			r.AddAttrs(slog.Any(f.Key, f.Value()))
+		}
+	}
+	if e.Stack != "" {
+		r.AddAttrs(slog.String(FieldKeyStacktrace, e.Stack))
+	}
+	return w.l.Handler().Handle(ctx, r)
+}
+
+// Write logs p, e.g. a line from a foreign logger, as an info message.
+func (w *SlogWriter) Write(p []byte) (int, error) {
+	r := slog.NewRecord(time.Now(), slog.LevelInfo, string(trimNewline(p)), 0)
+	return len(p), w.l.Handler().Handle(context.Background(), r)
+}
+
+func trimNewline(p []byte) []byte {
+	if n := len(p); n > 0 && p[n-1] == '\n' {
+		return p[:n-1]
+	}
+	return p
+}
@@ -0,0 +1,102 @@
+//go:build go1.21
+
+package cuslog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSlogHandlerLevels(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(WithOutput(&buf), WithFormatter(&JsonFormatter{DisableTimestamp: true}),
+		WithDisableCaller(true), WithLevel(TraceLevel))
+	sl := slog.New(NewSlogHandler(l))
+
+	levels := []slog.Level{slog.LevelDebug - 4, slog.LevelDebug, slog.LevelInfo, slog.LevelInfo + 1,
+		slog.LevelWarn, slog.LevelError, slog.LevelError + 4}
+	for _, level := range levels {
+		sl.Log(context.Background(), level, "m")
+	}
+	want := []string{"TRACE", "DEBUG", "INFO", "INFO", "WARN", "ERROR", "ERROR"}
+	entries := decodeLines(t, &buf)
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e["level"] != want[i] {
+			t.Errorf("%v: level %v, want %s", levels[i], e["level"], want[i])
+		}
+	}
+
+	l.SetLevel(WarnLevel)
+	if sl.Enabled(context.Background(), slog.LevelInfo) || !sl.Enabled(context.Background(), slog.LevelWarn) {
+		t.Error("Enabled doesn't follow the level of the logger")
+	}
+}
+
+func TestSlogHandlerGroups(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(WithOutput(&buf), WithFormatter(&JsonFormatter{DisableTimestamp: true}), WithDisableCaller(true))
+	sl := slog.New(NewSlogHandler(l)).With("app", "api").WithGroup("req").With("id", "r1")
+	sl.Info("served", slog.Group("user", "name", "bob"), "status", 200, slog.Group("empty"))
+
+	e := decodeLines(t, &buf)[0]
+	for key, want := range map[string]interface{}{
+		"app": "api", "req.id": "r1", "req.user.name": "bob", "req.status": float64(200), "message": "served",
+	} {
+		if e[key] != want {
+			t.Errorf("%s = %v, want %v", key, e[key], want)
+		}
+	}
+	if _, ok := e["req.empty"]; ok {
+		t.Error("empty group logged")
+	}
+}
+
+func TestSlogHandlerCaller(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(WithOutput(&buf), WithFormatter(&JsonFormatter{DisableTimestamp: true}))
+	sl := slog.New(NewSlogHandler(l))
+
+	_, file, line, _ := runtime.Caller(0)
+	sl.Info("here")
+	l.SetOptions(WithDisableCaller(true))
+	sl.Info("no caller")
+
+	entries := decodeLines(t, &buf)
+	if want := fmt.Sprintf("%s:%d", file, line+1); entries[0]["file"] != want {
+		t.Errorf("caller %v, want %s", entries[0]["file"], want)
+	}
+	if f, _ := entries[0]["func"].(string); !strings.HasSuffix(f, "TestSlogHandlerCaller") {
+		t.Errorf("func %q", f)
+	}
+	if _, ok := entries[1]["file"]; ok {
+		t.Errorf("caller %v logged with the caller disabled", entries[1]["file"])
+	}
+}
+
+func TestSlogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewSlogWriter(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	l := New(WithOutput(w), WithDisableCaller(true), WithLevel(TraceLevel))
+	l.Named("db").Warnw("slow", String("table", "users"))
+	l.Trace("below debug")
+	_, _ = w.Write([]byte("foreign line\n"))
+
+	entries := decodeLines(t, &buf)
+	if len(entries) != 2 {
+		t.Fatalf("got %d records, want 2: %s", len(entries), buf.String())
+	}
+	if e := entries[0]; e["level"] != "WARN" || e["msg"] != "slow" || e["logger"] != "db" || e["table"] != "users" {
+		t.Errorf("record %v", e)
+	}
+	if e := entries[1]; e["level"] != "INFO" || e["msg"] != "foreign line" {
+		t.Errorf("record %v", e)
+	}
+}
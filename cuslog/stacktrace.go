@@ -0,0 +1,118 @@
+package cuslog
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// addStack sets the stack of e when its level is at or above the
+// stacktrace level: the stack of the first logged error implementing
+// StackTrace(), else the stack of the logging goroutine.
+func (e *Entry) addStack() {
+	o := e.opt
+	if !o.addStack || e.Level < o.stackLevel {
+		return
+	}
+	if pcs := e.errorStack(); pcs != nil {
+		e.Stack = formatStack(pcs, false)
+		return
+	}
+	e.Stack = formatStack(callers(2), true)
+}
+
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, 64)
+	for {
+		n := runtime.Callers(skip+1, pcs)
+		if n < len(pcs) {
+			return pcs[:n]
+		}
+		pcs = make([]uintptr, len(pcs)*2)
+	}
+}
+
+// errorStack returns the origin stack of the first error of e carrying
+// one, nil if there is none.
+func (e *Entry) errorStack() []uintptr {
+	for _, f := range e.TypedFields {
+		if f.Type == ErrorType {
+			if pcs := stackOf(f.Interface.(error)); pcs != nil {
+				return pcs
+			}
+		}
+	}
+	for _, v := range e.Map {
+		if err, ok := v.(error); ok {
+			if pcs := stackOf(err); pcs != nil {
+				return pcs
+			}
+		}
+	}
+	for _, arg := range e.Args {
+		if err, ok := arg.(error); ok {
+			if pcs := stackOf(err); pcs != nil {
+				return pcs
+			}
+		}
+	}
+	return nil
+}
+
+// stackOf returns the stack of the innermost error in the chain of err
+// with a StackTrace method returning a slice of program counters, such as
+// the errors of github.com/pkg/errors.
+func stackOf(err error) []uintptr {
+	var pcs []uintptr
+	for ; err != nil; err = errors.Unwrap(err) {
+		m := reflect.ValueOf(err).MethodByName("StackTrace")
+		if !m.IsValid() || m.Type().NumIn() != 0 || m.Type().NumOut() != 1 {
+			continue
+		}
+		st := m.Call(nil)[0]
+		if st.Kind() != reflect.Slice || st.Type().Elem().Kind() != reflect.Uintptr {
+			continue
+		}
+		pcs = make([]uintptr, st.Len())
+		for i := range pcs {
+			pcs[i] = uintptr(st.Index(i).Uint())
+		}
+	}
+	return pcs
+}
+
+// formatStack renders pcs like a goroutine trace in a panic, optionally
+// without the leading frames of cuslog and log/slog.
+func formatStack(pcs []uintptr, trim bool) string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if trim && isLoggingFrame(frame.Function) {
+			if !more {
+				break
+			}
+			continue
+		}
+		trim = false
+
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(frame.Function)
+		b.WriteString("()\n\t")
+		b.WriteString(frame.File)
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(frame.Line))
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+func isLoggingFrame(function string) bool {
+	return strings.HasPrefix(function, "cuslog.") || strings.HasPrefix(function, "log/slog.")
+}
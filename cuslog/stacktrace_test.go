@@ -0,0 +1,19 @@
+package cuslog
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSampledOutEntriesSkipStack(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector allocates")
+	}
+	l := New(WithOutput(io.Discard), WithDisableCaller(true), WithStacktraceLevel(InfoLevel),
+		WithSampling(Sampling{Tick: time.Hour, First: 1}))
+	l.Info("hot")
+	if n := testing.AllocsPerRun(100, func() { l.Info("hot") }); n > 1 {
+		t.Errorf("%v allocs per sampled out entry, the stack was captured", n)
+	}
+}
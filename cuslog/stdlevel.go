@@ -0,0 +1,74 @@
+package cuslog
+
+import "bytes"
+
+// maxLevelPrefix is how far into a line a bracketed level is looked for,
+// past e.g. the date and time of the log package.
+const maxLevelPrefix = 64
+
+var levelAliases = map[string]Level{
+	"warning": WarnLevel,
+	"err":     ErrorLevel,
+}
+
+// detectLevel looks for the level of a foreign log line in a bracketed
+// prefix, e.g. [WARN] or [GIN-debug], which is removed from the line, or
+// in a logfmt level=error pair.
+func detectLevel(line []byte) (Level, []byte, bool) {
+	head := line
+	if len(head) > maxLevelPrefix {
+		head = head[:maxLevelPrefix]
+	}
+	for off := 0; ; {
+		i := bytes.IndexByte(head[off:], '[')
+		if i < 0 {
+			break
+		}
+		i += off
+		j := bytes.IndexByte(head[i:], ']')
+		if j < 0 {
+			break
+		}
+		name := head[i+1 : i+j]
+		if k := bytes.LastIndexByte(name, '-'); k >= 0 {
+			name = name[k+1:]
+		}
+		if level, ok := parseLevelName(name); ok {
+			msg := make([]byte, 0, len(line))
+			msg = append(msg, line[:i]...)
+			msg = append(msg, bytes.TrimLeft(line[i+j+1:], " ")...)
+			return level, msg, true
+		}
+		off = i + j
+	}
+
+	for off := 0; ; {
+		i := bytes.Index(line[off:], []byte("level="))
+		if i < 0 {
+			break
+		}
+		i += off
+		if i == 0 || line[i-1] == ' ' {
+			v := bytes.TrimPrefix(line[i+len("level="):], []byte{'"'})
+			if end := bytes.IndexAny(v, "\" "); end >= 0 {
+				v = v[:end]
+			}
+			if level, ok := parseLevelName(v); ok {
+				return level, line, true
+			}
+		}
+		off = i + len("level=")
+	}
+	return 0, line, false
+}
+
+func parseLevelName(name []byte) (Level, bool) {
+	if len(name) == 0 {
+		return 0, false
+	}
+	if level, ok := levelAliases[string(bytes.ToLower(name))]; ok {
+		return level, true
+	}
+	var level Level
+	return level, level.unmarshalText(name)
+}
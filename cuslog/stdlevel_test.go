@@ -0,0 +1,53 @@
+package cuslog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDetectLevel(t *testing.T) {
+	tests := []struct {
+		line  string
+		level Level
+		msg   string
+		ok    bool
+	}{
+		{"[WARN] disk almost full", WarnLevel, "disk almost full", true},
+		{"[GIN-debug] GET /ping --> main.ping", DebugLevel, "GET /ping --> main.ping", true},
+		{"[sarama] [error] broker down", ErrorLevel, "[sarama] broker down", true},
+		{"2024/05/01 12:00:00 [ERROR] connection reset", ErrorLevel, "2024/05/01 12:00:00 connection reset", true},
+		{"2024/05/01 12:00:00 [warning] slow", WarnLevel, "2024/05/01 12:00:00 slow", true},
+		{`time=now level=error msg="boom"`, ErrorLevel, `time=now level=error msg="boom"`, true},
+		{`level="warn" msg=x`, WarnLevel, `level="warn" msg=x`, true},
+		{"loglevel=error is a flag", 0, "loglevel=error is a flag", false},
+		{"2024/05/01 12:00:00 server started", 0, "2024/05/01 12:00:00 server started", false},
+		{"[id=42] no level here", 0, "[id=42] no level here", false},
+	}
+	for _, tt := range tests {
+		level, msg, ok := detectLevel([]byte(tt.line))
+		if ok != tt.ok || (ok && level != tt.level) || string(msg) != tt.msg {
+			t.Errorf("detectLevel(%q) = %v, %q, %v, want %v, %q, %v", tt.line, level, msg, ok, tt.level, tt.msg, tt.ok)
+		}
+	}
+}
+
+func TestWriteSplitsLines(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(WithOutput(&buf), WithFormatter(&JsonFormatter{DisableTimestamp: true}), WithDisableCaller(true),
+		WithLevel(DebugLevel), WithStdLevel(InfoLevel), WithStdLevelDetection(true))
+
+	data := []byte("[WARN] one\r\n\n  \ntwo\n[GIN-debug] three")
+	if n, err := l.Write(data); n != len(data) || err != nil {
+		t.Errorf("Write = %d, %v, want %d, nil", n, err, len(data))
+	}
+	want := [][2]string{{"WARN", "one"}, {"INFO", "two"}, {"DEBUG", "three"}}
+	entries := decodeLines(t, &buf)
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e["level"] != want[i][0] || e["message"] != want[i][1] {
+			t.Errorf("entry %d = %v %v, want %s %s", i, e["level"], e["message"], want[i][0], want[i][1])
+		}
+	}
+}
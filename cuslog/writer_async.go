@@ -0,0 +1,166 @@
+package cuslog
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// AsyncPolicy decides what an AsyncWriter does when its queue is full.
+type AsyncPolicy uint8
+
+const (
+	// AsyncBlock blocks the caller until there is room in the queue.
+	AsyncBlock AsyncPolicy = iota
+	// AsyncDropOldest discards the oldest queued entry to make room.
+	AsyncDropOldest
+	// AsyncDropNewest discards the entry being written.
+	AsyncDropNewest
+)
+
+var ErrAsyncClosed = errors.New("cuslog: async writer is closed")
+
+// AsyncWriter copies every write into a bounded queue which is drained
+// to the underlying writer by a background goroutine.
+type AsyncWriter struct {
+	out     io.Writer
+	policy  AsyncPolicy
+	queue   chan []byte
+	flush   chan chan struct{}
+	stopped chan struct{}
+	dropped uint64
+
+	mu     sync.RWMutex // guards closed against concurrent writes
+	closed bool
+	pool   sync.Pool
+
+	holders int32 // options using w in async mode, see WithOptions
+}
+
+func NewAsyncWriter(out io.Writer, queueSize int, policy AsyncPolicy) *AsyncWriter {
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+	w := &AsyncWriter{
+		out:     out,
+		policy:  policy,
+		queue:   make(chan []byte, queueSize),
+		flush:   make(chan chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	w.pool.New = func() interface{} { return make([]byte, 0, 256) }
+	go w.run()
+	return w
+}
+
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return 0, ErrAsyncClosed
+	}
+
+	buf := append(w.pool.Get().([]byte)[:0], p...)
+	switch w.policy {
+	case AsyncDropNewest:
+		select {
+		case w.queue <- buf:
+		default:
+			atomic.AddUint64(&w.dropped, 1)
+			w.pool.Put(buf[:0])
+		}
+	case AsyncDropOldest:
+		for {
+			select {
+			case w.queue <- buf:
+				return len(p), nil
+			default:
+			}
+			select {
+			case old := <-w.queue:
+				atomic.AddUint64(&w.dropped, 1)
+				w.pool.Put(old[:0])
+			default:
+			}
+		}
+	default:
+		w.queue <- buf
+	}
+	return len(p), nil
+}
+
+// Dropped returns the number of entries discarded because the queue was full.
+func (w *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Flush blocks until every entry queued before the call has been written.
+func (w *AsyncWriter) Flush() error {
+	ack := make(chan struct{})
+	select {
+	case w.flush <- ack:
+		<-ack
+	case <-w.stopped:
+	}
+	return nil
+}
+
+// Sync flushes the queue and syncs the underlying writer if it is a Syncer.
+func (w *AsyncWriter) Sync() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if s, ok := w.out.(Syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// Close drains the queue and stops the background goroutine.
+// The underlying writer is not closed.
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	<-w.stopped
+	return nil
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.stopped)
+	for {
+		select {
+		case buf, ok := <-w.queue:
+			if !ok {
+				return
+			}
+			w.write(buf)
+		case ack := <-w.flush:
+			w.drain()
+			close(ack)
+		}
+	}
+}
+
+func (w *AsyncWriter) drain() {
+	for {
+		select {
+		case buf, ok := <-w.queue:
+			if !ok {
+				return
+			}
+			w.write(buf)
+		default:
+			return
+		}
+	}
+}
+
+func (w *AsyncWriter) write(buf []byte) {
+	_, _ = w.out.Write(buf)
+	w.pool.Put(buf[:0])
+}
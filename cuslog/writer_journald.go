@@ -0,0 +1,160 @@
+package cuslog
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JournaldSocket is the default path of the journald native socket.
+const JournaldSocket = "/run/systemd/journal/socket"
+
+// JournaldWriter sends entries to journald using its native protocol.
+// Fields become journal fields, with keys upper-cased and characters
+// other than A-Z, 0-9 and _ replaced. Entries must fit in one datagram,
+// larger ones fail with the error of the socket.
+type JournaldWriter struct {
+	Path             string
+	SyslogIdentifier string
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+// NewJournaldWriter connects to the journald socket at JournaldSocket.
+func NewJournaldWriter(identifier string) (*JournaldWriter, error) {
+	if identifier == "" {
+		identifier = filepath.Base(os.Args[0])
+	}
+	w := &JournaldWriter{Path: JournaldSocket, SyslogIdentifier: identifier}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *JournaldWriter) connect() error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: w.Path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+func (w *JournaldWriter) WriteEntry(e *Entry) error {
+	buf := w.header(make([]byte, 0, 256), e.Level, e.Msg())
+	if e.Name != "" {
+		buf = appendJournalField(buf, "LOGGER", e.Name)
+	}
+	if e.File != "" {
+		buf = appendJournalField(buf, "CODE_FILE", e.File)
+		buf = appendJournalField(buf, "CODE_LINE", strconv.Itoa(e.Line))
+	}
+	if e.Func != "" {
+		buf = appendJournalField(buf, "CODE_FUNC", e.Func)
+	}
+	for _, k := range sortedKeys(e.Map) {
+		buf = appendJournalField(buf, journalKey(k), fieldText(e.Map[k]))
+	}
+	for _, f := range e.TypedFields {
+		if f.Type != SkipType {
+			buf = appendJournalField(buf, journalKey(f.Key), string(f.appendText(nil)))
+		}
+	}
+	if e.Stack != "" {
+		buf = appendJournalField(buf, "STACKTRACE", e.Stack)
+	}
+	return w.send(buf)
+}
+
+// Write sends p, e.g. the output of a formatter, as an info message.
+func (w *JournaldWriter) Write(p []byte) (int, error) {
+	buf := w.header(make([]byte, 0, len(p)+64), InfoLevel, strings.TrimSuffix(string(p), "\n"))
+	if err := w.send(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *JournaldWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *JournaldWriter) header(buf []byte, level Level, msg string) []byte {
+	buf = appendJournalField(buf, "MESSAGE", msg)
+	buf = appendJournalField(buf, "PRIORITY", strconv.Itoa(syslogSeverity(level)))
+	if w.SyslogIdentifier != "" {
+		buf = appendJournalField(buf, "SYSLOG_IDENTIFIER", w.SyslogIdentifier)
+	}
+	return buf
+}
+
+func (w *JournaldWriter) send(buf []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return err
+		}
+	}
+	_, err := w.conn.Write(buf)
+	return err
+}
+
+// appendJournalField appends KEY=value, or the length-prefixed binary form
+// if value contains a newline.
+func appendJournalField(buf []byte, key, value string) []byte {
+	if key == "" {
+		return buf
+	}
+	buf = append(buf, key...)
+	if strings.IndexByte(value, '\n') < 0 {
+		buf = append(buf, '=')
+		buf = append(buf, value...)
+		return append(buf, '\n')
+	}
+	buf = append(buf, '\n')
+	var n [8]byte
+	binary.LittleEndian.PutUint64(n[:], uint64(len(value)))
+	buf = append(buf, n[:]...)
+	buf = append(buf, value...)
+	return append(buf, '\n')
+}
+
+// journalKey turns a field key into a valid journal field name. Names
+// can't start with an underscore, which marks trusted fields, or a digit.
+func journalKey(key string) string {
+	b := make([]byte, 0, len(key))
+	for i := 0; i < len(key) && len(b) < 64; i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		default:
+			c = '_'
+		}
+		if len(b) == 0 && c == '_' {
+			continue
+		}
+		b = append(b, c)
+	}
+	if len(b) > 0 && b[0] >= '0' && b[0] <= '9' {
+		b = append([]byte("F_"), b...)
+	}
+	return string(b)
+}
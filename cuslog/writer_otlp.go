@@ -0,0 +1,344 @@
+package cuslog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OTLPConfig configures an OTLPExporter.
+type OTLPConfig struct {
+	// Endpoint is the OTLP/HTTP logs URL of the collector,
+	// http://localhost:4318/v1/logs if empty.
+	Endpoint    string
+	Headers     map[string]string
+	ServiceName string
+	// SpanContext returns the hex trace and span ids of the span in ctx,
+	// e.g. from trace.SpanContextFromContext with OpenTelemetry. Records
+	// have no trace correlation if nil.
+	SpanContext func(ctx context.Context) (traceID, spanID string)
+
+	QueueSize     int           // records, 2048 if 0
+	BatchSize     int           // records, 512 if 0
+	FlushInterval time.Duration // 1s if 0
+	Timeout       time.Duration // of an export request, 10s if 0
+	Client        *http.Client
+}
+
+// OTLPExporter exports entries as OTLP log records, JSON encoded, to an
+// OpenTelemetry collector, for use with WithOutput or as the Writer of a
+// Sink. Records are queued and sent in batches by a background goroutine;
+// when the queue is full new records are dropped.
+type OTLPExporter struct {
+	cfg      OTLPConfig
+	resource []byte // encoded resource of the batches
+
+	queue   chan []byte
+	flush   chan chan error
+	stopped chan struct{}
+	dropped uint64
+
+	mu     sync.RWMutex // guards closed against concurrent writes
+	closed bool
+}
+
+func NewOTLPExporter(cfg OTLPConfig) *OTLPExporter {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "http://localhost:4318/v1/logs"
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 2048
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 512
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: cfg.Timeout}
+	}
+	x := &OTLPExporter{
+		cfg:     cfg,
+		queue:   make(chan []byte, cfg.QueueSize),
+		flush:   make(chan chan error),
+		stopped: make(chan struct{}),
+	}
+	x.resource = []byte(`{"attributes":[`)
+	if cfg.ServiceName != "" {
+		x.resource = appendOTLPAttr(x.resource, String("service.name", cfg.ServiceName))
+	}
+	x.resource = append(x.resource, "]}"...)
+	go x.run()
+	return x
+}
+
+func (x *OTLPExporter) WriteEntry(e *Entry) error {
+	return x.enqueue(x.record(e))
+}
+
+// Write exports p, e.g. the output of a formatter, as an info record.
+func (x *OTLPExporter) Write(p []byte) (int, error) {
+	rec := []byte(`{"timeUnixNano":"`)
+	rec = strconv.AppendInt(rec, time.Now().UnixNano(), 10)
+	rec = append(rec, `","severityNumber":9,"severityText":"INFO","body":{"stringValue":`...)
+	rec = appendJSONString(rec, string(bytes.TrimSuffix(p, []byte{'\n'})))
+	rec = append(rec, "}}"...)
+	if err := x.enqueue(rec); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (x *OTLPExporter) enqueue(rec []byte) error {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if x.closed {
+		return ErrAsyncClosed
+	}
+
+	select {
+	case x.queue <- rec:
+	default:
+		atomic.AddUint64(&x.dropped, 1)
+	}
+	return nil
+}
+
+// Dropped returns the number of records discarded because the queue was
+// full or their export failed.
+func (x *OTLPExporter) Dropped() uint64 {
+	return atomic.LoadUint64(&x.dropped)
+}
+
+// Flush blocks until every record queued before the call has been sent,
+// and returns the error of the failed exports if any.
+func (x *OTLPExporter) Flush() error {
+	ack := make(chan error)
+	select {
+	case x.flush <- ack:
+		return <-ack
+	case <-x.stopped:
+		return nil
+	}
+}
+
+func (x *OTLPExporter) Sync() error {
+	return x.Flush()
+}
+
+// Close sends the queued records and stops the background goroutine.
+func (x *OTLPExporter) Close() error {
+	x.mu.Lock()
+	if !x.closed {
+		x.closed = true
+		close(x.queue)
+	}
+	x.mu.Unlock()
+	<-x.stopped
+	return nil
+}
+
+func (x *OTLPExporter) run() {
+	defer close(x.stopped)
+
+	ticker := time.NewTicker(x.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([][]byte, 0, x.cfg.BatchSize)
+	var err error // of the exports since the last flush
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if serr := x.send(batch); serr != nil {
+			atomic.AddUint64(&x.dropped, uint64(len(batch)))
+			fmt.Fprintf(os.Stderr, "cuslog: failed to export %d log records: %v\n", len(batch), serr)
+			err = serr
+		}
+		batch = batch[:0]
+	}
+	add := func(rec []byte) {
+		if batch = append(batch, rec); len(batch) >= x.cfg.BatchSize {
+			send()
+		}
+	}
+
+	for {
+		select {
+		case rec, ok := <-x.queue:
+			if !ok {
+				send()
+				return
+			}
+			add(rec)
+		case <-ticker.C:
+			send()
+		case ack := <-x.flush:
+		drain:
+			for {
+				select {
+				case rec, ok := <-x.queue:
+					if !ok {
+						break drain
+					}
+					add(rec)
+				default:
+					break drain
+				}
+			}
+			send()
+			ack <- err
+			err = nil
+		}
+	}
+}
+
+func (x *OTLPExporter) send(batch [][]byte) error {
+	body := append(make([]byte, 0, 4096), `{"resourceLogs":[{"resource":`...)
+	body = append(body, x.resource...)
+	body = append(body, `,"scopeLogs":[{"scope":{"name":"cuslog"},"logRecords":[`...)
+	for i, rec := range batch {
+		if i > 0 {
+			body = append(body, ',')
+		}
+		body = append(body, rec...)
+	}
+	body = append(body, "]}]}]}"...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), x.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, x.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range x.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := x.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+// record encodes e as an OTLP log record.
+func (x *OTLPExporter) record(e *Entry) []byte {
+	rec := make([]byte, 0, 256)
+	rec = append(rec, `{"timeUnixNano":"`...)
+	rec = strconv.AppendInt(rec, e.Time.UnixNano(), 10)
+	rec = append(rec, `","severityNumber":`...)
+	rec = strconv.AppendInt(rec, int64(otlpSeverity(e.Level)), 10)
+	rec = append(rec, `,"severityText":`...)
+	rec = appendJSONString(rec, e.Level.String())
+	rec = append(rec, `,"body":{"stringValue":`...)
+	rec = appendJSONString(rec, e.Msg())
+	rec = append(rec, `},"attributes":[`...)
+	if e.Name != "" {
+		rec = appendOTLPAttr(rec, String(FieldKeyName, e.Name))
+	}
+	if e.File != "" {
+		rec = appendOTLPAttr(rec, String("code.filepath", e.File))
+		rec = appendOTLPAttr(rec, Int("code.lineno", e.Line))
+	}
+	if e.Func != "" {
+		rec = appendOTLPAttr(rec, String("code.function", e.Func))
+	}
+	for _, k := range sortedKeys(e.Map) {
+		rec = appendOTLPAttr(rec, Any(k, e.Map[k]))
+	}
+	for _, f := range e.TypedFields {
+		rec = appendOTLPAttr(rec, f)
+	}
+	if e.Stack != "" {
+		rec = appendOTLPAttr(rec, String("code.stacktrace", e.Stack))
+	}
+	rec = append(rec, ']')
+
+	if x.cfg.SpanContext != nil && e.Context != nil {
+		if traceID, spanID := x.cfg.SpanContext(e.Context); traceID != "" {
+			rec = append(rec, `,"traceId":`...)
+			rec = appendJSONString(rec, traceID)
+			if spanID != "" {
+				rec = append(rec, `,"spanId":`...)
+				rec = appendJSONString(rec, spanID)
+			}
+		}
+	}
+	return append(rec, '}')
+}
+
+// otlpSeverity maps a level to an OTLP severity number, using the four
+// numbers of each built-in level for the custom levels above it, e.g.
+// INFO3 for a level 5 above InfoLevel.
+func otlpSeverity(level Level) int {
+	n := 1 + int(level)*4/10
+	if n > 24 {
+		n = 24
+	}
+	return n
+}
+
+// appendOTLPAttr appends f as an OTLP key/value attribute, preceded by a
+// comma unless first.
+func appendOTLPAttr(dst []byte, f Field) []byte {
+	if f.Type == SkipType {
+		return dst
+	}
+	if dst[len(dst)-1] != '[' {
+		dst = append(dst, ',')
+	}
+	dst = append(dst, `{"key":`...)
+	dst = appendJSONString(dst, f.Key)
+	dst = append(dst, `,"value":{`...)
+	switch f.Type {
+	case IntType:
+		dst = append(dst, `"intValue":"`...)
+		dst = strconv.AppendInt(dst, f.Integer, 10)
+		dst = append(dst, '"')
+	case UintType:
+		if f.Integer < 0 { // above math.MaxInt64
+			dst = append(dst, `"stringValue":"`...)
+			dst = strconv.AppendUint(dst, uint64(f.Integer), 10)
+			dst = append(dst, '"')
+		} else {
+			dst = append(dst, `"intValue":"`...)
+			dst = strconv.AppendInt(dst, f.Integer, 10)
+			dst = append(dst, '"')
+		}
+	case BoolType:
+		dst = append(dst, `"boolValue":`...)
+		dst = strconv.AppendBool(dst, f.Integer == 1)
+	case FloatType:
+		if v := math.Float64frombits(uint64(f.Integer)); !math.IsNaN(v) && !math.IsInf(v, 0) {
+			dst = append(dst, `"doubleValue":`...)
+			dst = strconv.AppendFloat(dst, v, 'g', -1, 64)
+			break
+		}
+		dst = append(dst, `"stringValue":`...)
+		dst = appendJSONString(dst, string(f.appendText(nil)))
+	case AnyType:
+		dst = append(dst, `"stringValue":`...)
+		dst = appendJSONString(dst, string(appendJSONValue(nil, f.Interface)))
+	default:
+		dst = append(dst, `"stringValue":`...)
+		dst = appendJSONString(dst, string(f.appendText(nil)))
+	}
+	return append(dst, "}}"...)
+}
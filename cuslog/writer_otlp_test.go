@@ -0,0 +1,20 @@
+package cuslog
+
+import "testing"
+
+func TestOTLPSeverity(t *testing.T) {
+	for level, want := range map[Level]int{
+		TraceLevel: 1,
+		DebugLevel: 5,
+		InfoLevel:  9,
+		25:         11,
+		WarnLevel:  13,
+		ErrorLevel: 17,
+		PanicLevel: 21,
+		FatalLevel: 24,
+	} {
+		if got := otlpSeverity(level); got != want {
+			t.Errorf("otlpSeverity(%v) = %d, want %d", level, got, want)
+		}
+	}
+}
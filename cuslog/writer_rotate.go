@@ -0,0 +1,333 @@
+package cuslog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+	compressSuffix   = ".gz"
+	megabyte         = 1024 * 1024
+)
+
+// RotateWriter writes to Filename and rotates it when it grows over MaxSize
+// megabytes or, with Daily set, on the first write of a new day. Rotated
+// files are renamed to name-<time>.ext next to Filename.
+type RotateWriter struct {
+	Filename   string
+	MaxSize    int           // megabytes, 0 disables size based rotation
+	MaxAge     time.Duration // 0 keeps backups regardless of age
+	MaxBackups int           // 0 keeps all backups
+	Daily      bool
+	Compress   bool
+	LocalTime  bool
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	openDay time.Time
+	signals chan os.Signal
+	closed  bool
+
+	millMu sync.Mutex
+}
+
+func NewRotateWriter(filename string) *RotateWriter {
+	return &RotateWriter{Filename: filename}
+}
+
+// Write appends p to the file, opening or rotating it first if needed. It
+// returns os.ErrClosed once the writer is closed.
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.file == nil {
+		if err := w.openExisting(); err != nil {
+			return 0, err
+		}
+	}
+	if w.shouldRotate(len(p)) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *RotateWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.signals != nil {
+		signal.Stop(w.signals)
+		close(w.signals)
+		w.signals = nil
+	}
+	w.closed = true
+	return w.close()
+}
+
+// Rotate closes the current file, moves it aside and opens a new one.
+func (w *RotateWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+// Reopen closes and reopens Filename without renaming it, for use after
+// an external tool such as logrotate has moved the file.
+func (w *RotateWriter) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// a signal may be handled after Close
+	if w.closed {
+		return os.ErrClosed
+	}
+	if err := w.close(); err != nil {
+		return err
+	}
+	return w.openExisting()
+}
+
+// ReopenOnSignal calls Reopen whenever one of sigs is received, SIGHUP if
+// none given. It stops listening when the writer is closed.
+func (w *RotateWriter) ReopenOnSignal(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.signals != nil || w.closed {
+		return
+	}
+	w.signals = make(chan os.Signal, 1)
+	signal.Notify(w.signals, sigs...)
+	go func(ch chan os.Signal) {
+		for range ch {
+			_ = w.Reopen()
+		}
+	}(w.signals)
+}
+
+func (w *RotateWriter) shouldRotate(n int) bool {
+	if w.MaxSize > 0 && w.size > 0 && w.size+int64(n) > int64(w.MaxSize)*megabyte {
+		return true
+	}
+	return w.Daily && !day(w.now()).Equal(w.openDay)
+}
+
+func (w *RotateWriter) now() time.Time {
+	if w.LocalTime {
+		return time.Now()
+	}
+	return time.Now().UTC()
+}
+
+func day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+func (w *RotateWriter) openExisting() error {
+	if err := os.MkdirAll(filepath.Dir(w.Filename), 0755); err != nil {
+		return err
+	}
+	fd, err := os.OpenFile(w.Filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return err
+	}
+
+	w.file, w.size = fd, info.Size()
+	modTime := info.ModTime()
+	if !w.LocalTime {
+		modTime = modTime.UTC()
+	}
+	w.openDay = day(modTime)
+	return nil
+}
+
+func (w *RotateWriter) close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *RotateWriter) rotate() error {
+	if err := w.close(); err != nil {
+		return err
+	}
+
+	now := w.now()
+	if _, err := os.Stat(w.Filename); err == nil {
+		if err := os.Rename(w.Filename, w.backupName(now)); err != nil {
+			return err
+		}
+	}
+
+	fd, err := os.OpenFile(w.Filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w.file, w.size, w.openDay = fd, 0, day(now)
+
+	go w.mill()
+	return nil
+}
+
+func (w *RotateWriter) prefixAndExt() (string, string) {
+	base := filepath.Base(w.Filename)
+	ext := filepath.Ext(base)
+	return base[:len(base)-len(ext)] + "-", ext
+}
+
+func (w *RotateWriter) backupName(t time.Time) string {
+	prefix, ext := w.prefixAndExt()
+	return filepath.Join(filepath.Dir(w.Filename), prefix+t.Format(backupTimeFormat)+ext)
+}
+
+type backupFile struct {
+	name string
+	time time.Time
+}
+
+// backups returns the rotated files of w sorted newest first.
+func (w *RotateWriter) backups() ([]backupFile, error) {
+	dir := filepath.Dir(w.Filename)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, ext := w.prefixAndExt()
+	var files []backupFile
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		ts := strings.TrimSuffix(name, compressSuffix)
+		if !strings.HasPrefix(ts, prefix) || !strings.HasSuffix(ts, ext) {
+			continue
+		}
+		ts = ts[len(prefix) : len(ts)-len(ext)]
+		t, err := time.Parse(backupTimeFormat, ts)
+		if err != nil {
+			continue
+		}
+		files = append(files, backupFile{name: filepath.Join(dir, name), time: t})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].time.After(files[j].time) })
+	return files, nil
+}
+
+// mill applies the MaxBackups, MaxAge and Compress settings to the backups.
+func (w *RotateWriter) mill() {
+	w.millMu.Lock()
+	defer w.millMu.Unlock()
+
+	files, err := w.backups()
+	if err != nil {
+		return
+	}
+
+	cutoff := time.Time{}
+	if w.MaxAge > 0 {
+		cutoff = time.Now().Add(-w.MaxAge)
+	}
+	for i, f := range files {
+		// backup names carry wall clock digits only, compare them that way
+		expired := !cutoff.IsZero() && f.time.Before(wallClock(cutoff, w.LocalTime))
+		if (w.MaxBackups > 0 && i >= w.MaxBackups) || expired {
+			_ = os.Remove(f.name)
+			continue
+		}
+		if w.Compress && !strings.HasSuffix(f.name, compressSuffix) {
+			_ = compressFile(f.name)
+		}
+	}
+}
+
+func wallClock(t time.Time, local bool) time.Time {
+	if !local {
+		t = t.UTC()
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+func compressFile(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(name+compressSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(name + compressSuffix)
+		}
+	}()
+
+	gz := gzip.NewWriter(dst)
+	if _, err = io.Copy(gz, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err = gz.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
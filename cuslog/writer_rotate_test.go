@@ -0,0 +1,156 @@
+package cuslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// backupNames returns the base names of the rotated files of w.
+func backupNames(t *testing.T, w *RotateWriter) []string {
+	t.Helper()
+	files, err := w.backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, filepath.Base(f.name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeBackup creates a rotated file of w as if rotated at ts.
+func writeBackup(t *testing.T, w *RotateWriter, ts time.Time, content string) string {
+	t.Helper()
+	name := w.backupName(ts)
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Base(name)
+}
+
+func TestRotateWriterSize(t *testing.T) {
+	w := &RotateWriter{Filename: filepath.Join(t.TempDir(), "app.log"), MaxSize: 1}
+	defer w.Close()
+
+	chunk := bytes.Repeat([]byte("x"), 600*1024)
+	for i := 0; i < 2; i++ {
+		if n, err := w.Write(chunk); err != nil || n != len(chunk) {
+			t.Fatalf("write: %d, %v", n, err)
+		}
+	}
+	backups := backupNames(t, w)
+	if len(backups) != 1 {
+		t.Fatalf("backups %q, want 1", backups)
+	}
+	info, err := os.Stat(w.Filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(chunk)) {
+		t.Errorf("current file has %d bytes, want %d", info.Size(), len(chunk))
+	}
+}
+
+func TestRotateWriterMaxBackups(t *testing.T) {
+	w := &RotateWriter{Filename: filepath.Join(t.TempDir(), "app.log"), MaxBackups: 2}
+	now := time.Now().UTC()
+	var names []string
+	for i := 0; i < 4; i++ {
+		names = append(names, writeBackup(t, w, now.Add(time.Duration(i-4)*time.Minute), "old"))
+	}
+	w.mill()
+
+	if got := backupNames(t, w); len(got) != 2 || got[0] != names[2] || got[1] != names[3] {
+		t.Errorf("backups %q, want the newest two of %q", got, names)
+	}
+}
+
+func TestRotateWriterMaxAge(t *testing.T) {
+	w := &RotateWriter{Filename: filepath.Join(t.TempDir(), "app.log"), MaxAge: time.Hour}
+	now := time.Now().UTC()
+	writeBackup(t, w, now.Add(-2*time.Hour), "expired")
+	kept := writeBackup(t, w, now.Add(-time.Minute), "recent")
+	w.mill()
+
+	if got := backupNames(t, w); len(got) != 1 || got[0] != kept {
+		t.Errorf("backups %q, want %s", got, kept)
+	}
+}
+
+func TestRotateWriterCompress(t *testing.T) {
+	w := &RotateWriter{Filename: filepath.Join(t.TempDir(), "app.log"), Compress: true}
+	name := writeBackup(t, w, time.Now().UTC(), "rotated line\n")
+	w.mill()
+
+	if got := backupNames(t, w); len(got) != 1 || got[0] != name+compressSuffix {
+		t.Fatalf("backups %q, want %s", got, name+compressSuffix)
+	}
+	fd, err := os.Open(filepath.Join(filepath.Dir(w.Filename), name+compressSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	gz, err := gzip.NewReader(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(gz)
+	if err != nil || string(content) != "rotated line\n" {
+		t.Errorf("decompressed %q, %v", content, err)
+	}
+}
+
+func TestRotateWriterReopen(t *testing.T) {
+	dir := t.TempDir()
+	w := &RotateWriter{Filename: filepath.Join(dir, "app.log")}
+	defer w.Close()
+
+	_, _ = w.Write([]byte("before\n"))
+	// like logrotate moving the file away
+	moved := filepath.Join(dir, "app.log.1")
+	if err := os.Rename(w.Filename, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("after\n"))
+
+	for name, want := range map[string]string{moved: "before\n", w.Filename: "after\n"} {
+		if got, err := os.ReadFile(name); err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v, want %q", filepath.Base(name), got, err, want)
+		}
+	}
+}
+
+func TestRotateWriterClosed(t *testing.T) {
+	w := &RotateWriter{Filename: filepath.Join(t.TempDir(), "app.log")}
+	_, _ = w.Write([]byte("line\n"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(w.Filename); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte("late\n")); err != os.ErrClosed {
+		t.Errorf("write after close: %v", err)
+	}
+	if err := w.Reopen(); err != os.ErrClosed {
+		t.Errorf("reopen after close: %v", err)
+	}
+	if err := w.Rotate(); err != os.ErrClosed {
+		t.Errorf("rotate after close: %v", err)
+	}
+	if _, err := os.Stat(w.Filename); !os.IsNotExist(err) {
+		t.Errorf("file reopened after close: %v", err)
+	}
+}
@@ -0,0 +1,559 @@
+package cuslog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ShipProtocol is how a Shipper sends its batches.
+type ShipProtocol uint8
+
+const (
+	// ShipTCP writes the entries, e.g. NDJSON from JsonFormatter, to a tcp
+	// connection to Addr.
+	ShipTCP ShipProtocol = iota
+	// ShipLoki posts the entries to the Loki push API at Addr, e.g.
+	// http://loki:3100/loki/api/v1/push.
+	ShipLoki
+	// ShipElasticsearch posts the entries, which must be JSON objects, to
+	// the Elasticsearch bulk API at Addr, e.g. http://es:9200/_bulk.
+	ShipElasticsearch
+)
+
+// ShipperConfig configures a Shipper.
+type ShipperConfig struct {
+	Protocol ShipProtocol
+	Addr     string
+	Headers  map[string]string // of the http requests
+	// Labels are the labels of the Loki stream, {job="cuslog"} if empty.
+	Labels map[string]string
+	// Index is the Elasticsearch index, "logs" if empty.
+	Index string
+
+	QueueSize     int           // entries, 4096 if 0
+	BatchSize     int           // entries, 512 if 0
+	FlushInterval time.Duration // 1s if 0
+	Timeout       time.Duration // of a send, 10s if 0
+
+	MaxRetries int           // retries of a failed send, 5 if 0
+	MinBackoff time.Duration // 100ms if 0, doubled on each retry
+	MaxBackoff time.Duration // 10s if 0
+
+	// SpillDir keeps the batches which could not be sent, to be resent
+	// when the endpoint is back. They are dropped if empty.
+	SpillDir     string
+	MaxSpillSize int64 // bytes, 100MB if 0
+
+	Client *http.Client
+}
+
+// ShipperStats are the counters of a Shipper.
+type ShipperStats struct {
+	SentBatches    uint64
+	Retries        uint64
+	SpilledBatches uint64 // written to the spill dir
+	DroppedBatches uint64 // neither sent nor spilled
+	// DroppedEntries counts the entries of the dropped batches, those an
+	// Elasticsearch bulk response reports as failed and those discarded
+	// because the queue was full.
+	DroppedEntries uint64
+}
+
+// Shipper is an output sending the formatted entries to a remote
+// collector in batches from a background goroutine. When the queue is
+// full new entries are dropped.
+type Shipper struct {
+	cfg ShipperConfig
+
+	queue   chan shipEntry
+	flush   chan chan error
+	closing chan struct{}
+	stopped chan struct{}
+	stats   ShipperStats // updated atomically
+
+	mu     sync.RWMutex // guards closed against concurrent writes
+	closed bool
+
+	conn      net.Conn // of ShipTCP
+	spillSize int64
+	spillSeq  uint64
+}
+
+type shipEntry struct {
+	line []byte
+	time time.Time
+}
+
+// errPermanent wraps the errors a retry can't fix, e.g. a bad request.
+type errPermanent struct{ error }
+
+// errRejected is the error of a batch the collector accepted except for
+// some of its entries. It isn't retried, resending the batch would
+// duplicate the accepted entries.
+type errRejected struct {
+	error
+	entries int
+}
+
+// retryable reports whether resending a batch may fix err.
+func retryable(err error) bool {
+	switch err.(type) {
+	case errPermanent, errRejected:
+		return false
+	}
+	return true
+}
+
+func NewShipper(cfg ShipperConfig) *Shipper {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 4096
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 512
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = 5
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 100 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 10 * time.Second
+	}
+	if cfg.MaxSpillSize <= 0 {
+		cfg.MaxSpillSize = 100 * megabyte
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: cfg.Timeout}
+	}
+	s := &Shipper{
+		cfg:     cfg,
+		queue:   make(chan shipEntry, cfg.QueueSize),
+		flush:   make(chan chan error),
+		closing: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	s.spillSize = s.spilledSize()
+	go s.run()
+	return s
+}
+
+func (s *Shipper) Write(p []byte) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return 0, ErrAsyncClosed
+	}
+
+	select {
+	case s.queue <- shipEntry{line: append([]byte(nil), p...), time: time.Now()}:
+	default:
+		atomic.AddUint64(&s.stats.DroppedEntries, 1)
+	}
+	return len(p), nil
+}
+
+// Stats returns the counters of s.
+func (s *Shipper) Stats() ShipperStats {
+	return ShipperStats{
+		SentBatches:    atomic.LoadUint64(&s.stats.SentBatches),
+		Retries:        atomic.LoadUint64(&s.stats.Retries),
+		SpilledBatches: atomic.LoadUint64(&s.stats.SpilledBatches),
+		DroppedBatches: atomic.LoadUint64(&s.stats.DroppedBatches),
+		DroppedEntries: atomic.LoadUint64(&s.stats.DroppedEntries),
+	}
+}
+
+// Dropped returns the number of entries which were neither sent nor
+// spilled.
+func (s *Shipper) Dropped() uint64 {
+	return atomic.LoadUint64(&s.stats.DroppedEntries)
+}
+
+// Flush blocks until every entry queued before the call has been sent or
+// spilled, and returns the error of the failed sends if any.
+func (s *Shipper) Flush() error {
+	ack := make(chan error)
+	select {
+	case s.flush <- ack:
+		return <-ack
+	case <-s.stopped:
+		return nil
+	}
+}
+
+func (s *Shipper) Sync() error {
+	return s.Flush()
+}
+
+// Close sends the queued entries, spilling them without retrying if the
+// endpoint is down, and stops the background goroutine.
+func (s *Shipper) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.closing)
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	<-s.stopped
+	return nil
+}
+
+func (s *Shipper) run() {
+	defer close(s.stopped)
+	defer func() {
+		if s.conn != nil {
+			_ = s.conn.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]shipEntry, 0, s.cfg.BatchSize)
+	var err error // of the sends since the last flush
+	ship := func() {
+		if len(batch) > 0 {
+			if serr := s.ship(batch); serr != nil {
+				err = serr
+			}
+			batch = batch[:0]
+		} else if s.spillSize > 0 {
+			s.unspill()
+		}
+	}
+	add := func(e shipEntry) {
+		if batch = append(batch, e); len(batch) >= s.cfg.BatchSize {
+			ship()
+		}
+	}
+
+	for {
+		select {
+		case e, ok := <-s.queue:
+			if !ok {
+				ship()
+				return
+			}
+			add(e)
+		case <-ticker.C:
+			ship()
+		case ack := <-s.flush:
+		drain:
+			for {
+				select {
+				case e, ok := <-s.queue:
+					if !ok {
+						break drain
+					}
+					add(e)
+				default:
+					break drain
+				}
+			}
+			ship()
+			ack <- err
+			err = nil
+		}
+	}
+}
+
+// ship sends batch after the spilled batches, retrying on failure, and
+// spills it if it still can't be sent.
+func (s *Shipper) ship(batch []shipEntry) error {
+	body := s.encode(batch)
+	if s.spillSize > 0 && !s.unspill() {
+		// the endpoint is still down, keep the order of the batches
+		s.spill(body, len(batch))
+		return nil
+	}
+	err := s.sendRetry(body)
+	if err == nil {
+		atomic.AddUint64(&s.stats.SentBatches, 1)
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "cuslog: failed to ship %d entries to %s: %v\n", len(batch), s.cfg.Addr, err)
+	switch err := err.(type) {
+	case errRejected:
+		s.drop(err.entries)
+	case errPermanent:
+		s.drop(len(batch))
+	default:
+		s.spill(body, len(batch))
+	}
+	return err
+}
+
+func (s *Shipper) sendRetry(body []byte) error {
+	backoff := s.cfg.MinBackoff
+	for retry := 0; ; retry++ {
+		err := s.send(body)
+		if err == nil {
+			return nil
+		}
+		if !retryable(err) || retry == s.cfg.MaxRetries {
+			return err
+		}
+		// jitter of up to a fifth of the backoff
+		wait := backoff + time.Duration(rand.Int63n(int64(backoff)/5+1))
+		select {
+		case <-time.After(wait):
+		case <-s.closing:
+			return err
+		}
+		atomic.AddUint64(&s.stats.Retries, 1)
+		if backoff *= 2; backoff > s.cfg.MaxBackoff {
+			backoff = s.cfg.MaxBackoff
+		}
+	}
+}
+
+// encode returns the payload of batch in the format of the protocol.
+func (s *Shipper) encode(batch []shipEntry) []byte {
+	var buf []byte
+	switch s.cfg.Protocol {
+	case ShipLoki:
+		buf = append(buf, `{"streams":[{"stream":{`...)
+		labels := s.cfg.Labels
+		if len(labels) == 0 {
+			labels = map[string]string{"job": "cuslog"}
+		}
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			buf = appendJSONKey(buf, k)
+			buf = appendJSONString(buf, labels[k])
+		}
+		buf = append(buf, `},"values":[`...)
+		for i, e := range batch {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(buf, `["`...)
+			buf = strconv.AppendInt(buf, e.time.UnixNano(), 10)
+			buf = append(buf, `",`...)
+			buf = appendJSONString(buf, string(bytes.TrimRight(e.line, "\n")))
+			buf = append(buf, ']')
+		}
+		buf = append(buf, "]}]}"...)
+	case ShipElasticsearch:
+		index := s.cfg.Index
+		if index == "" {
+			index = "logs"
+		}
+		action := appendJSONString([]byte(`{"index":{"_index":`), index)
+		action = append(action, "}}\n"...)
+		for _, e := range batch {
+			buf = append(buf, action...)
+			buf = append(buf, bytes.TrimRight(e.line, "\n")...)
+			buf = append(buf, '\n')
+		}
+	default:
+		for _, e := range batch {
+			buf = append(buf, e.line...)
+			if len(e.line) > 0 && e.line[len(e.line)-1] != '\n' {
+				buf = append(buf, '\n')
+			}
+		}
+	}
+	return buf
+}
+
+func (s *Shipper) send(body []byte) error {
+	if s.cfg.Protocol == ShipTCP {
+		return s.sendTCP(body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.Addr, bytes.NewReader(body))
+	if err != nil {
+		return errPermanent{err}
+	}
+	if s.cfg.Protocol == ShipElasticsearch {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	var rejected error
+	if s.cfg.Protocol == ShipElasticsearch && resp.StatusCode/100 == 2 {
+		rejected = bulkErrors(resp.Body)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode/100 == 2:
+		return rejected
+	case resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusRequestTimeout &&
+		resp.StatusCode != http.StatusTooManyRequests:
+		return errPermanent{fmt.Errorf("collector responded %s", resp.Status)}
+	}
+	return fmt.Errorf("collector responded %s", resp.Status)
+}
+
+// bulkErrors returns an errRejected if the Elasticsearch bulk response r,
+// sent with a 2xx status, reports entries which failed.
+func bulkErrors(r io.Reader) error {
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := jsoniter.NewDecoder(r).Decode(&resp); err != nil || !resp.Errors {
+		return nil
+	}
+	rejected, reason := 0, ""
+	for _, item := range resp.Items {
+		for _, result := range item {
+			if result.Status/100 == 2 {
+				continue
+			}
+			if rejected++; reason == "" {
+				reason = result.Error.Type + ": " + result.Error.Reason
+			}
+		}
+	}
+	if rejected == 0 {
+		return nil
+	}
+	return errRejected{fmt.Errorf("elasticsearch rejected %d of %d entries, %s", rejected, len(resp.Items), reason), rejected}
+}
+
+func (s *Shipper) sendTCP(body []byte) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout("tcp", s.cfg.Addr, s.cfg.Timeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(s.cfg.Timeout))
+	if _, err := s.conn.Write(body); err != nil {
+		// a partial write leaves the stream unusable, reconnect on retry
+		_ = s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *Shipper) drop(entries int) {
+	atomic.AddUint64(&s.stats.DroppedBatches, 1)
+	atomic.AddUint64(&s.stats.DroppedEntries, uint64(entries))
+}
+
+// spill writes the payload of a batch to the spill dir, or drops it if
+// there is no spill dir or it is full.
+func (s *Shipper) spill(body []byte, entries int) {
+	if s.cfg.SpillDir == "" || s.spillSize+int64(len(body)) > s.cfg.MaxSpillSize {
+		s.drop(entries)
+		return
+	}
+	s.spillSeq++
+	name := filepath.Join(s.cfg.SpillDir, fmt.Sprintf("cuslog-%020d-%06d.spill", time.Now().UnixNano(), s.spillSeq%1000000))
+	if err := os.MkdirAll(s.cfg.SpillDir, 0755); err != nil {
+		s.drop(entries)
+		return
+	}
+	if err := os.WriteFile(name, body, 0644); err != nil {
+		_ = os.Remove(name)
+		s.drop(entries)
+		return
+	}
+	s.spillSize += int64(len(body))
+	atomic.AddUint64(&s.stats.SpilledBatches, 1)
+}
+
+// unspill sends the spilled batches, oldest first, without retrying. It
+// reports whether all of them were sent.
+func (s *Shipper) unspill() bool {
+	for _, name := range s.spillFiles() {
+		body, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		err = s.send(body)
+		if err != nil && retryable(err) {
+			s.spillSize = s.spilledSize()
+			return false
+		}
+		switch err := err.(type) {
+		case nil:
+			atomic.AddUint64(&s.stats.SentBatches, 1)
+		case errRejected:
+			s.drop(err.entries)
+		default:
+			atomic.AddUint64(&s.stats.DroppedBatches, 1)
+		}
+		_ = os.Remove(name)
+	}
+	// the unreadable batches are still there
+	s.spillSize = s.spilledSize()
+	return true
+}
+
+// spilledSize returns the size of the spilled batches.
+func (s *Shipper) spilledSize() int64 {
+	var size int64
+	for _, f := range s.spillFiles() {
+		if fi, err := os.Stat(f); err == nil {
+			size += fi.Size()
+		}
+	}
+	return size
+}
+
+// spillFiles returns the spilled batches, oldest first.
+func (s *Shipper) spillFiles() []string {
+	if s.cfg.SpillDir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(s.cfg.SpillDir)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if name := e.Name(); strings.HasPrefix(name, "cuslog-") && strings.HasSuffix(name, ".spill") {
+			names = append(names, filepath.Join(s.cfg.SpillDir, name))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,346 @@
+package cuslog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector is an http endpoint answering with the queued statuses, then
+// 200 and reply, and recording the bodies it accepted.
+type collector struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	down     bool
+	reply    string
+	bodies   []string
+	requests int
+}
+
+func newCollector() *collector {
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.requests++
+		if c.down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if len(c.statuses) > 0 {
+			status := c.statuses[0]
+			c.statuses = c.statuses[1:]
+			w.WriteHeader(status)
+			return
+		}
+		c.bodies = append(c.bodies, string(body))
+		_, _ = io.WriteString(w, c.reply)
+	}))
+	return c
+}
+
+func (c *collector) setDown(down bool) {
+	c.mu.Lock()
+	c.down = down
+	c.mu.Unlock()
+}
+
+func (c *collector) requestCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests
+}
+
+func (c *collector) accepted() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.bodies...)
+}
+
+func fastShipper(cfg ShipperConfig) *Shipper {
+	cfg.MinBackoff, cfg.MaxBackoff = time.Millisecond, 4*time.Millisecond
+	if cfg.FlushInterval == 0 {
+		cfg.FlushInterval = time.Hour
+	}
+	return NewShipper(cfg)
+}
+
+func spilled(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
+
+func TestShipperRetry(t *testing.T) {
+	c := newCollector()
+	defer c.Close()
+	c.statuses = []int{http.StatusTooManyRequests, http.StatusBadGateway}
+	s := fastShipper(ShipperConfig{Protocol: ShipLoki, Addr: c.URL, MaxRetries: 3})
+	defer s.Close()
+
+	_, _ = s.Write([]byte("one\n"))
+	if err := s.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if got := len(c.accepted()); got != 1 {
+		t.Fatalf("accepted %d batches, want 1", got)
+	}
+	if st := s.Stats(); st.SentBatches != 1 || st.Retries != 2 || st.DroppedBatches != 0 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestShipperRetriesExhausted(t *testing.T) {
+	c := newCollector()
+	defer c.Close()
+	c.setDown(true)
+	s := fastShipper(ShipperConfig{Protocol: ShipLoki, Addr: c.URL, MaxRetries: 2})
+	defer s.Close()
+
+	_, _ = s.Write([]byte("one\n"))
+	_, _ = s.Write([]byte("two\n"))
+	if err := s.Flush(); err == nil {
+		t.Error("flush: no error")
+	}
+	if n := c.requestCount(); n != 3 {
+		t.Errorf("%d requests, want 1 plus 2 retries", n)
+	}
+	// no spill dir, the batch is dropped
+	if st := s.Stats(); st.Retries != 2 || st.DroppedBatches != 1 || st.DroppedEntries != 2 || s.Dropped() != 2 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestShipperPermanentError(t *testing.T) {
+	c := newCollector()
+	defer c.Close()
+	c.statuses = []int{http.StatusBadRequest}
+	dir := t.TempDir()
+	s := fastShipper(ShipperConfig{Protocol: ShipLoki, Addr: c.URL, SpillDir: dir})
+	defer s.Close()
+
+	_, _ = s.Write([]byte("bad\n"))
+	if err := s.Flush(); err == nil {
+		t.Error("flush: no error")
+	}
+	if n := c.requestCount(); n != 1 || spilled(t, dir) != 0 {
+		t.Errorf("%d requests and %d spilled, want 1 request and no spill", n, spilled(t, dir))
+	}
+	if st := s.Stats(); st.Retries != 0 || st.DroppedBatches != 1 || st.SpilledBatches != 0 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestShipperSpillAndReplay(t *testing.T) {
+	c := newCollector()
+	defer c.Close()
+	c.setDown(true)
+	dir := t.TempDir()
+	s := fastShipper(ShipperConfig{Protocol: ShipElasticsearch, Addr: c.URL, SpillDir: dir, MaxRetries: 1})
+	defer s.Close()
+
+	_, _ = s.Write([]byte(`{"n":1}` + "\n"))
+	_ = s.Flush()
+	_, _ = s.Write([]byte(`{"n":2}` + "\n"))
+	_ = s.Flush()
+	if n := spilled(t, dir); n != 2 {
+		t.Fatalf("%d spilled batches, want 2", n)
+	}
+	// the second batch is spilled at once while the endpoint is down
+	if st := s.Stats(); st.Retries != 1 || st.SpilledBatches != 2 || st.DroppedBatches != 0 {
+		t.Errorf("stats %+v", st)
+	}
+
+	c.setDown(false)
+	_, _ = s.Write([]byte(`{"n":3}` + "\n"))
+	if err := s.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	bodies := c.accepted()
+	if len(bodies) != 3 {
+		t.Fatalf("accepted %d batches, want 3", len(bodies))
+	}
+	for i, body := range bodies {
+		want := `{"index":{"_index":"logs"}}` + "\n" + `{"n":` + string(rune('1'+i)) + "}\n"
+		if body != want {
+			t.Errorf("batch %d = %q, want %q", i, body, want)
+		}
+	}
+	if n := spilled(t, dir); n != 0 {
+		t.Errorf("%d batches left in the spill dir", n)
+	}
+	if st := s.Stats(); st.SentBatches != 3 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestShipperElasticsearchItemErrors(t *testing.T) {
+	c := newCollector()
+	defer c.Close()
+	c.reply = `{"took":3,"errors":true,"items":[{"index":{"status":201}},` +
+		`{"index":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue full"}}}]}`
+	dir := t.TempDir()
+	s := fastShipper(ShipperConfig{Protocol: ShipElasticsearch, Addr: c.URL, SpillDir: dir})
+	defer s.Close()
+
+	_, _ = s.Write([]byte(`{"n":1}` + "\n"))
+	_, _ = s.Write([]byte(`{"n":2}` + "\n"))
+	err := s.Flush()
+	if err == nil || !strings.Contains(err.Error(), "rejected 1 of 2 entries") {
+		t.Errorf("flush: %v", err)
+	}
+	// resending would duplicate the first entry
+	if n := c.requestCount(); n != 1 || spilled(t, dir) != 0 {
+		t.Errorf("%d requests and %d spilled, want 1 request and no spill", n, spilled(t, dir))
+	}
+	if st := s.Stats(); st.SentBatches != 0 || st.DroppedBatches != 1 || st.DroppedEntries != 1 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestShipperUnreadableSpill(t *testing.T) {
+	c := newCollector()
+	defer c.Close()
+	dir := t.TempDir()
+	unreadable := filepath.Join(dir, "cuslog-00000000000000000001-000001.spill")
+	if err := os.Mkdir(unreadable, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cuslog-00000000000000000002-000002.spill"), []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := fastShipper(ShipperConfig{Protocol: ShipLoki, Addr: c.URL, SpillDir: dir})
+	defer s.Close()
+
+	_, _ = s.Write([]byte("new\n"))
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if bodies := c.accepted(); len(bodies) != 2 || bodies[0] != "old\n" {
+		t.Errorf("accepted %q, want the spilled batch, then the new one", bodies)
+	}
+	fi, err := os.Stat(unreadable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.spillSize != fi.Size() {
+		t.Errorf("spill size %d, want %d of the batch left", s.spillSize, fi.Size())
+	}
+}
+
+func TestShipperReplaysSpillOfPreviousRun(t *testing.T) {
+	c := newCollector()
+	defer c.Close()
+	c.setDown(true)
+	dir := t.TempDir()
+	s := fastShipper(ShipperConfig{Protocol: ShipLoki, Addr: c.URL, SpillDir: dir, MaxRetries: 1})
+	_, _ = s.Write([]byte("kept\n"))
+	_ = s.Close()
+	if n := spilled(t, dir); n != 1 {
+		t.Fatalf("%d spilled batches, want 1", n)
+	}
+
+	c.setDown(false)
+	s = fastShipper(ShipperConfig{Protocol: ShipLoki, Addr: c.URL, SpillDir: dir, FlushInterval: 5 * time.Millisecond})
+	defer s.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for spilled(t, dir) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	bodies := c.accepted()
+	if len(bodies) != 1 || !strings.Contains(bodies[0], `"kept"`) {
+		t.Errorf("accepted %q", bodies)
+	}
+}
+
+func TestShipperLokiPayload(t *testing.T) {
+	c := newCollector()
+	defer c.Close()
+	s := fastShipper(ShipperConfig{Protocol: ShipLoki, Addr: c.URL, Labels: map[string]string{"job": "api", "env": "prod"}})
+	defer s.Close()
+
+	_, _ = s.Write([]byte("level=info msg=\"a \\\"b\\\"\"\n"))
+	_, _ = s.Write([]byte("second"))
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	bodies := c.accepted()
+	if len(bodies) != 1 {
+		t.Fatalf("accepted %d batches, want 1", len(bodies))
+	}
+	if err := json.Unmarshal([]byte(bodies[0]), &push); err != nil {
+		t.Fatalf("decode %q: %v", bodies[0], err)
+	}
+	stream := push.Streams[0]
+	if stream.Stream["job"] != "api" || stream.Stream["env"] != "prod" || len(stream.Values) != 2 {
+		t.Fatalf("stream %+v", stream)
+	}
+	if v := stream.Values[0]; v[1] != `level=info msg="a \"b\""` || len(v[0]) < 19 {
+		t.Errorf("value %q", v)
+	}
+	if v := stream.Values[1]; v[1] != "second" {
+		t.Errorf("value %q", v)
+	}
+}
+
+func TestShipperTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 4)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sc := bufio.NewScanner(conn)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+
+	s := fastShipper(ShipperConfig{Protocol: ShipTCP, Addr: ln.Addr().String()})
+	l := New(WithOutput(s), WithFormatter(&JsonFormatter{DisableTimestamp: true}), WithDisableCaller(true))
+	l.Info("one")
+	l.Warn("two")
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`{"level":"INFO","message":"one"}`, `{"level":"WARN","message":"two"}`} {
+		select {
+		case got := <-lines:
+			if got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s", want)
+		}
+	}
+	if _, err := s.Write([]byte("late\n")); err != ErrAsyncClosed {
+		t.Errorf("write after close: %v", err)
+	}
+}
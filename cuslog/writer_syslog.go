@@ -0,0 +1,265 @@
+package cuslog
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Syslog facilities, see RFC 5424 section 6.2.1.
+const (
+	FacilityKern   = 0
+	FacilityUser   = 1
+	FacilityDaemon = 3
+	FacilityLocal0 = 16
+	FacilityLocal7 = 23
+)
+
+const syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// syslogSeverity maps a level, or the built-in level below a custom one,
+// to a syslog severity.
+func syslogSeverity(level Level) int {
+	switch {
+	case level < InfoLevel:
+		return 7
+	case level < WarnLevel:
+		return 6
+	case level < ErrorLevel:
+		return 4
+	case level < PanicLevel:
+		return 3
+	case level < FatalLevel:
+		return 2
+	}
+	return 1
+}
+
+// SyslogWriter sends entries as RFC 5424 messages over udp, tcp or a unix
+// socket. Fields are sent as the parameters of the structured data
+// element SDID, and each entry as one datagram, or framed by octet
+// counting (RFC 6587) on stream connections.
+type SyslogWriter struct {
+	Network  string
+	Addr     string
+	Facility int
+	AppName  string
+	Hostname string
+	// SDID is the id of the structured data element, "fields@32473" if
+	// empty.
+	SDID string
+
+	mu       sync.Mutex
+	conn     net.Conn
+	datagram bool // conn is udp or unixgram, unframed
+}
+
+// NewSyslogWriter connects to the syslog server at addr. For the unix
+// network both datagram and stream sockets are tried.
+func NewSyslogWriter(network, addr, appName string) (*SyslogWriter, error) {
+	hostname, _ := os.Hostname()
+	if appName == "" {
+		appName = filepath.Base(os.Args[0])
+	}
+	w := &SyslogWriter{
+		Network:  network,
+		Addr:     addr,
+		Facility: FacilityUser,
+		AppName:  appName,
+		Hostname: hostname,
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *SyslogWriter) connect() error {
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+	if w.Network == "unix" {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.Dial(network, w.Addr); err == nil {
+				w.conn, w.datagram = conn, network == "unixgram"
+				return nil
+			}
+		}
+		return fmt.Errorf("cuslog: can't connect to syslog socket %s", w.Addr)
+	}
+	conn, err := net.Dial(w.Network, w.Addr)
+	if err != nil {
+		return err
+	}
+	switch w.Network {
+	case "udp", "udp4", "udp6", "unixgram":
+		w.datagram = true
+	default:
+		w.datagram = false
+	}
+	w.conn = conn
+	return nil
+}
+
+func (w *SyslogWriter) WriteEntry(e *Entry) error {
+	return w.send(w.format(e.Level, e.Time, e.Msg(), e))
+}
+
+// Write sends p, e.g. the output of a formatter, as an info message.
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	if err := w.send(w.format(InfoLevel, time.Now(), msg, nil)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// format renders an RFC 5424 message, with the fields of e if not nil.
+func (w *SyslogWriter) format(level Level, t time.Time, msg string, e *Entry) []byte {
+	buf := make([]byte, 0, 256)
+	buf = append(buf, '<')
+	buf = strconv.AppendInt(buf, int64(w.Facility*8+syslogSeverity(level)), 10)
+	buf = append(buf, ">1 "...)
+	buf = t.AppendFormat(buf, syslogTimeFormat)
+	buf = append(buf, ' ')
+	buf = appendSyslogHeader(buf, w.Hostname, 255)
+	buf = append(buf, ' ')
+	buf = appendSyslogHeader(buf, w.AppName, 48)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, int64(os.Getpid()), 10)
+	buf = append(buf, " - "...)
+	buf = w.appendStructuredData(buf, e)
+	if msg != "" {
+		buf = append(buf, ' ')
+		buf = append(buf, msg...)
+	}
+	return buf
+}
+
+func (w *SyslogWriter) appendStructuredData(buf []byte, e *Entry) []byte {
+	if e == nil || (len(e.Map) == 0 && len(e.TypedFields) == 0 && e.Name == "" && e.File == "" && e.Stack == "") {
+		return append(buf, '-')
+	}
+
+	sdid := w.SDID
+	if sdid == "" {
+		sdid = "fields@32473"
+	}
+	buf = append(buf, '[')
+	buf = append(buf, sdid...)
+	if e.Name != "" {
+		buf = appendSDParam(buf, FieldKeyName, e.Name)
+	}
+	if e.File != "" {
+		buf = appendSDParam(buf, "caller", shortPath(e.File)+":"+strconv.Itoa(e.Line))
+	}
+	for _, k := range sortedKeys(e.Map) {
+		buf = appendSDParam(buf, k, fieldText(e.Map[k]))
+	}
+	for _, f := range e.TypedFields {
+		if f.Type != SkipType {
+			buf = appendSDParam(buf, f.Key, string(f.appendText(nil)))
+		}
+	}
+	if e.Stack != "" {
+		buf = appendSDParam(buf, FieldKeyStacktrace, e.Stack)
+	}
+	return append(buf, ']')
+}
+
+// appendSDParam appends name="value" with name restricted to the
+// characters allowed by RFC 5424 and value escaped.
+func appendSDParam(buf []byte, name, value string) []byte {
+	buf = append(buf, ' ')
+	n := 0
+	for i := 0; i < len(name) && n < 32; i++ {
+		c := name[i]
+		if c <= ' ' || c > '~' || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		buf = append(buf, c)
+		n++
+	}
+	if n == 0 {
+		buf = append(buf, '_')
+	}
+	buf = append(buf, '=', '"')
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c == '"' || c == '\\' || c == ']' {
+			buf = append(buf, '\\')
+		}
+		buf = append(buf, value[i])
+	}
+	return append(buf, '"')
+}
+
+// appendSyslogHeader appends a header field, "-" if empty.
+func appendSyslogHeader(buf []byte, s string, max int) []byte {
+	if s == "" {
+		return append(buf, '-')
+	}
+	for i := 0; i < len(s) && i < max; i++ {
+		c := s[i]
+		if c <= ' ' || c > '~' {
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+func (w *SyslogWriter) send(msg []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return err
+		}
+	}
+	if err := w.write(msg); err != nil {
+		// the server may have gone away, reconnect once
+		if err := w.connect(); err != nil {
+			return err
+		}
+		return w.write(msg)
+	}
+	return nil
+}
+
+func (w *SyslogWriter) write(msg []byte) error {
+	if w.datagram {
+		_, err := w.conn.Write(msg)
+		return err
+	}
+	frame := strconv.AppendInt(make([]byte, 0, len(msg)+8), int64(len(msg)), 10)
+	frame = append(frame, ' ')
+	_, err := w.conn.Write(append(frame, msg...))
+	return err
+}
+
+// fieldText renders an untyped field value as text.
+func fieldText(v interface{}) string {
+	if err, ok := v.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprint(v)
+}
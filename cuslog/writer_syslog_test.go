@@ -0,0 +1,154 @@
+package cuslog
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogWriterUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	w, err := NewSyslogWriter("udp", pc.LocalAddr().String(), "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	l := New(WithOutput(w), WithDisableCaller(true))
+	l.Named("db").Warnw("slow query", String("table", "users"))
+
+	buf := make([]byte, 2048)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	if !strings.HasPrefix(msg, "<12>1 ") {
+		t.Errorf("priority of %q, want <12>1 for user.warning", msg)
+	}
+	if want := ` app ` + strconv.Itoa(os.Getpid()) + ` - [fields@32473 logger="db" table="users"] slow query`; !strings.HasSuffix(msg, want) {
+		t.Errorf("message %q, want suffix %q", msg, want)
+	}
+}
+
+func TestSyslogWriterUnixStreamFraming(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "syslog.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var buf bytes.Buffer
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _ = buf.ReadFrom(conn)
+		received <- buf.Bytes()
+	}()
+
+	w, err := NewSyslogWriter("unix", path, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := New(WithOutput(w), WithDisableCaller(true))
+	l.Info("one")
+	l.Info("two")
+	_ = w.Close()
+
+	// octet counting: "<len> <msg>" per entry
+	r := bufio.NewReader(bytes.NewReader(<-received))
+	var msgs []string
+	for {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			break
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+		if err != nil {
+			t.Fatalf("bad frame length %q", size)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, string(msg))
+	}
+	if len(msgs) != 2 || !strings.HasSuffix(msgs[0], " - - one") || !strings.HasSuffix(msgs[1], " - - two") {
+		t.Errorf("got frames %q", msgs)
+	}
+}
+
+func TestSyslogWriterUnixgram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "syslog.sock")
+	pc, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	w, err := NewSyslogWriter("unix", path, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	l := New(WithOutput(w), WithDisableCaller(true))
+	l.Error("boom")
+
+	buf := make([]byte, 2048)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := string(buf[:n]); !strings.HasPrefix(msg, "<11>1 ") || !strings.HasSuffix(msg, " - - boom") {
+		t.Errorf("datagram %q", msg)
+	}
+}
+
+func TestJournaldWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	pc, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	w := &JournaldWriter{Path: path, SyslogIdentifier: "app"}
+	if err := w.connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	l := New(WithOutput(w), WithDisableCaller(true))
+	l.Named("hub").Errorw("line one\nline two", String("user-id", "42"))
+
+	buf := make([]byte, 2048)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(buf[:n])
+	for _, want := range []string{"PRIORITY=3\n", "SYSLOG_IDENTIFIER=app\n", "LOGGER=hub\n", "USER_ID=42\n",
+		"MESSAGE\n\x11\x00\x00\x00\x00\x00\x00\x00line one\nline two\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("datagram %q lacks %q", got, want)
+		}
+	}
+}